@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
+	"sort"
+	"sync/atomic"
 	"syscall"
-	"time"
 
 	"github.com/HugeFrog24/gpt-video-transcriber/utils"
 
@@ -18,145 +21,539 @@ import (
 	"github.com/joho/godotenv"
 )
 
-const defaultDescriptionAttempts = 3
+// commands maps each subcommand to its entry point, which gets the
+// arguments after the subcommand name.
+var commands = map[string]func(args []string){
+	"process":    runProcess,
+	"transcribe": runTranscribe,
+	"describe":   runDescribe,
+	"evaluate":   runEvaluate,
+	"export":     runExport,
+	"status":     runStatus,
+	"migrate":    runMigrate,
+}
 
-func main() {
-	// Define command-line flags
-	descriptionCount := flag.Int("descriptions", defaultDescriptionAttempts, "Number of descriptions to generate for each video")
-	flag.Parse()
+const usage = `Usage: go run main.go <command> [flags] [arguments]
 
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+Commands:
+  process <video_or_directory>      transcribe, describe and rank (default)
+  transcribe <video_or_directory>   only extract audio and transcribe
+  describe [video ...]              regenerate descriptions from stored transcripts
+  evaluate [video ...]              re-rank stored descriptions
+  export -to <file>                 convert the results file to another format
+  status [directory]                summarize progress of the results file
+  migrate                           repair a results file from an earlier version
+
+Run 'go run main.go <command> -h' for the flags of a command.`
+
+func main() {
+	// Without a known command the arguments are those of process, as before
+	// subcommands existed
+	name, args := "process", os.Args[1:]
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+	if _, ok := commands[args[0]]; ok {
+		name, args = args[0], args[1:]
+	} else if args[0] == "help" {
+		fmt.Println(usage)
+		return
 	}
+	commands[name](args)
+}
+
+// commandLine holds the flags shared by every command. Their defaults only
+// document the built-in configuration; flags override the config file only
+// when given.
+type commandLine struct {
+	flags      *flag.FlagSet
+	configPath *string
+	overrides  map[string]func(cfg *utils.Config)
+}
 
-	// Create .tmp directory if it doesn't exist
-	tmpDir := ".tmp"
-	if err := os.MkdirAll(tmpDir, 0750); err != nil {
-		log.Fatalf("Failed to create .tmp directory: %v", err)
+func newCommandLine(name string) *commandLine {
+	defaults := utils.DefaultConfig()
+	c := &commandLine{
+		flags:     flag.NewFlagSet(name, flag.ExitOnError),
+		overrides: make(map[string]func(cfg *utils.Config)),
 	}
+	c.configPath = c.flags.String("config", "", "Path to a YAML configuration file")
+	c.stringFlag("output", defaults.Output, "Results file; a single video is only saved when this or -o is given", func(cfg *utils.Config, v string) { cfg.Output = v })
+	c.stringFlag("o", defaults.Output, "Shorthand for -output", func(cfg *utils.Config, v string) { cfg.Output = v })
+	c.stringFlag("format", defaults.Format, "Results file format: xml, json, jsonl or sqlite (default: from the -output extension)", func(cfg *utils.Config, v string) { cfg.Format = v })
+	c.intFlag("descriptions", defaults.Descriptions.Count, "Number of descriptions to generate for each video", func(cfg *utils.Config, v int) { cfg.Descriptions.Count = v })
+	c.stringFlag("transcriber", defaults.Transcription.Backend, "Transcription backend: openai, whisper-server or whisper-cpp", func(cfg *utils.Config, v string) { cfg.Transcription.Backend = v })
+	c.intFlag("workers", defaults.Processing.Workers, "Number of videos to process in parallel", func(cfg *utils.Config, v int) { cfg.Processing.Workers = v })
+	c.intFlag("max-attempts", defaults.Retry.MaxAttempts, "Maximum attempts per API request before giving up", func(cfg *utils.Config, v int) { cfg.Retry.MaxAttempts = v })
+	c.intFlag("chunk-workers", defaults.Transcription.ChunkWorkers, "Number of audio chunks of one video to transcribe in parallel", func(cfg *utils.Config, v int) { cfg.Transcription.ChunkWorkers = v })
+	c.boolFlag("sequential", defaults.Transcription.Sequential, "Transcribe chunks one after another, each continuing the previous transcript", func(cfg *utils.Config, v bool) { cfg.Transcription.Sequential = v })
+	c.stringFlag("diarization-url", defaults.Transcription.DiarizationURL, "Diarization service labelling segments with their speakers (default: none)", func(cfg *utils.Config, v string) { cfg.Transcription.DiarizationURL = v })
+	c.stringFlag("cache-dir", defaults.Transcription.CacheDir, "Directory caching transcripts by audio content (default: no cache)", func(cfg *utils.Config, v string) { cfg.Transcription.CacheDir = v })
+	c.boolFlag("keep-going", defaults.Processing.KeepGoing, "Record per-video failures in the results file and continue with the next video", func(cfg *utils.Config, v bool) { cfg.Processing.KeepGoing = v })
+	c.boolFlag("retry-failed", defaults.Processing.RetryFailedOnly, "Only reprocess videos whose stored result has an error", func(cfg *utils.Config, v bool) { cfg.Processing.RetryFailedOnly = v })
+	c.stringFlag("prompts", defaults.PromptsDir, "Directory with prompt templates overriding the built-in ones", func(cfg *utils.Config, v string) { cfg.PromptsDir = v })
+	c.stringFlag("glossary", defaults.Glossary, "Glossary file with terms to prompt Whisper with and corrections for the transcript", func(cfg *utils.Config, v string) { cfg.Glossary = v })
+	c.stringFlag("persona", defaults.Persona, "Persona profile from the config file to write descriptions as", func(cfg *utils.Config, v string) { cfg.Persona = v })
+	c.stringFlag("workdir", defaults.Processing.WorkDir, "Directory to create this run's temporary directory in (default: the system temp directory)", func(cfg *utils.Config, v string) { cfg.Processing.WorkDir = v })
+	c.boolFlag("keep-temp", defaults.Processing.KeepTemp, "Keep the extracted audio of this run for debugging", func(cfg *utils.Config, v bool) { cfg.Processing.KeepTemp = v })
+	c.stringFlag("subtitles", defaults.Processing.SubtitleFormat, "Write a sidecar subtitle file next to each video: srt or vtt", func(cfg *utils.Config, v string) { cfg.Processing.SubtitleFormat = v })
+	return c
+}
+
+func (c *commandLine) stringFlag(name, value, usage string, set func(cfg *utils.Config, v string)) {
+	p := c.flags.String(name, value, usage)
+	c.overrides[name] = func(cfg *utils.Config) { set(cfg, *p) }
+}
+
+func (c *commandLine) intFlag(name string, value int, usage string, set func(cfg *utils.Config, v int)) {
+	p := c.flags.Int(name, value, usage)
+	c.overrides[name] = func(cfg *utils.Config) { set(cfg, *p) }
+}
+
+func (c *commandLine) boolFlag(name string, value bool, usage string, set func(cfg *utils.Config, v bool)) {
+	p := c.flags.Bool(name, value, usage)
+	c.overrides[name] = func(cfg *utils.Config) { set(cfg, *p) }
+}
 
-	// Clean up .tmp directory at startup
-	cleanupTmpDir(tmpDir)
+// isSet reports whether the flag name was given on the command line.
+func (c *commandLine) isSet(name string) bool {
+	set := false
+	c.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
 
-	if flag.NArg() < 1 {
-		log.Fatal("Usage: go run main.go [-descriptions <number>] \"<video_file_path_or_directory>\"")
+// parse parses args, then merges defaults, config file and environment and
+// applies the flags that were given explicitly.
+func (c *commandLine) parse(args []string) utils.Config {
+	_ = c.flags.Parse(args)
+
+	cfg, err := utils.LoadConfig(*c.configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	inputPath := flag.Arg(0)
+	c.flags.Visit(func(f *flag.Flag) {
+		if set, ok := c.overrides[f.Name]; ok {
+			set(&cfg)
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	return cfg
+}
 
-	// Get the absolute path of the input
-	absInputPath, err := filepath.Abs(inputPath)
+// loadEnv loads API keys and backend settings from the .env file, if there
+// is one; job runners usually set the environment directly. Call it before
+// parse so the environment overrides take effect.
+func loadEnv() {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+}
+
+func openStore(cfg utils.Config) utils.ResultsStore {
+	store, err := utils.NewResultsStore(cfg.Output, cfg.Format)
 	if err != nil {
-		log.Fatalf("Failed to get absolute path: %v", err)
+		log.Fatalf("Failed to open results file: %v", err)
 	}
+	return store
+}
+
+func closeStore(store utils.ResultsStore) {
+	if err := store.Close(); err != nil {
+		log.Printf("Failed to close results file: %v", err)
+	}
+}
 
-	// Create a context that is cancelled on interrupt signal
+// exitInterrupted is the exit status of a run stopped by SIGINT or SIGTERM,
+// as shells report for a process killed by SIGINT.
+const exitInterrupted = 130
+
+// handleInterrupts returns the context for a run. The first SIGINT or
+// SIGTERM stops the run gracefully once the current stage is saved, the
+// second cancels the context to abort in-flight calls, and a third one
+// kills the process. interrupted reports whether a signal arrived; release
+// stops listening.
+func handleInterrupts() (ctx context.Context, interrupted *atomic.Bool, release func()) {
 	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, stop := utils.WithGracefulStop(ctx)
+	interrupted = new(atomic.Bool)
 
-	// Handle interrupt signal for cleanup
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
 	go func() {
-		<-c
-		fmt.Println("\nReceived interrupt signal, cleaning up...")
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		interrupted.Store(true)
+		fmt.Println("\nInterrupted: finishing the current stage, press Ctrl-C again to abort")
+		stop()
+
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		fmt.Println("\nAborting; finished stages are still saved")
+		// The results file is replaced atomically, so even a kill cannot
+		// leave it half written
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
 		cancel()
-		cleanupTmpDir(tmpDir)
-		os.Exit(1)
 	}()
 
+	return ctx, interrupted, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// finish exits with a status telling whether the command failed or was
+// interrupted. Call it after cleaning up: deferred calls do not run.
+func finish(err error, interrupted bool) {
+	switch {
+	case interrupted:
+		if err != nil && !errors.Is(err, utils.ErrStopped) {
+			log.Printf("Interrupted: %v", err)
+		}
+		log.Printf("Interrupted; run the same command again to resume")
+		os.Exit(exitInterrupted)
+	case err != nil:
+		log.Fatal(err)
+	}
+}
+
+// pipeline is everything process and transcribe need to run videos.
+type pipeline struct {
+	ctx         context.Context
+	interrupted *atomic.Bool
+	transcriber utils.AudioTranscriber
+	generator   utils.DescriptionGenerator
+	evaluator   utils.DescriptionEvaluator
+}
+
+// newPipeline creates this run's working directory, interrupt handling and
+// the backends, and records the working directory in cfg. Without describe
+// only the transcriber is created. The returned function cleans up and must
+// run before the command exits.
+func newPipeline(cfg *utils.Config, describe bool) (*pipeline, func()) {
+	workspace, err := utils.NewWorkspace(*cfg)
+	if err != nil {
+		log.Fatalf("Failed to create working directory: %v", err)
+	}
+	cfg.Processing.TempDir = workspace
+
+	p := &pipeline{}
+	ctx, interrupted, release := handleInterrupts()
+	p.ctx, p.interrupted = ctx, interrupted
+	cleanup := func() {
+		release()
+		if err := utils.RemoveWorkspace(*cfg, workspace); err != nil {
+			log.Printf("Failed to remove working directory %s: %v", workspace, err)
+		}
+	}
+
+	p.transcriber, err = utils.NewAudioTranscriber(*cfg)
+	if err != nil {
+		cleanup()
+		log.Fatalf("Failed to create audio transcriber: %v", err)
+	}
+	if describe {
+		p.generator, p.evaluator = newDescribers(*cfg)
+	}
+
+	return p, cleanup
+}
+
+// newDescribers selects the chat backend used for summaries, descriptions
+// and evaluation and loads the prompt templates.
+func newDescribers(cfg utils.Config) (utils.DescriptionGenerator, utils.DescriptionEvaluator) {
+	provider, err := utils.NewChatProvider(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create chat provider: %v", err)
+	}
+	// Load the prompt templates, with any overrides from the prompts directory
+	prompts, err := utils.LoadPrompts(cfg.PromptsDir)
+	if err != nil {
+		log.Fatalf("Failed to load prompts: %v", err)
+	}
+	return utils.NewRealDescriptionGenerator(provider, prompts, cfg), utils.NewRealDescriptionEvaluator(provider, prompts, cfg)
+}
+
+func runProcess(args []string) {
+	runPipeline("process", args, true)
+}
+
+func runTranscribe(args []string) {
+	runPipeline("transcribe", args, false)
+}
+
+// runPipeline handles process and transcribe, which differ only in whether
+// descriptions are generated after transcribing.
+func runPipeline(name string, args []string, describe bool) {
+	cl := newCommandLine(name)
+	streamName := cl.flags.String("name", "stdin", "File name of a video read from stdin, shown to the chat model")
+	loadEnv()
+	cfg := cl.parse(args)
+	if cl.flags.NArg() < 1 {
+		log.Fatalf("Usage: go run main.go %s [flags] \"<video_file_path_or_directory>\" (or - for stdin)", name)
+	}
+
+	if cl.flags.Arg(0) == utils.StdinInput {
+		// stdout carries only the JSON result; progress messages written
+		// with fmt.Print* go to stderr instead
+		resultOut := os.Stdout
+		os.Stdout = os.Stderr
+
+		p, cleanup := newPipeline(&cfg, describe)
+		err := processStream(p, cfg, *streamName, resultOut)
+		cleanup()
+		finish(err, p.interrupted.Load())
+		return
+	}
+
+	// Get the absolute path of the input
+	absInputPath, err := filepath.Abs(cl.flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to get absolute path: %v", err)
+	}
+
 	// Check if the input path is a directory or a file
 	info, err := os.Stat(absInputPath)
 	if err != nil {
 		log.Fatalf("Failed to stat input path: %v", err)
 	}
 
+	p, cleanup := newPipeline(&cfg, describe)
 	if info.IsDir() {
-		// Process directory
-		outputXML := "transcription_results.xml"
-		evaluator, err := utils.NewRealDescriptionEvaluator()
-		if err != nil {
-			log.Fatalf("Failed to create description evaluator: %v", err)
-		}
-		results, err := utils.ProcessDirectory(
-			ctx,
-			absInputPath,
-			outputXML,
-			*descriptionCount,
-			&utils.RealAudioExtractor{},
-			&utils.RealAudioTranscriber{},
-			&utils.RealDescriptionGenerator{},
-			evaluator,
-		)
-		if err != nil {
-			log.Fatalf("Failed to process directory: %v", err)
-		}
-		fmt.Printf("Transcription results saved to %s\n", outputXML)
-		fmt.Printf("Processed %d video(s)\n", len(results.Results))
+		err = processDirectory(p, cfg, absInputPath)
 	} else {
-		// Process single file
-		audioFile := filepath.Join(tmpDir, fmt.Sprintf("output_%d.wav", time.Now().Unix()))
-
-		// Check if the audio file already exists
-		if _, err := os.Stat(audioFile); err == nil {
-			fmt.Printf("File '%s' already exists. Overwrite? [y/N] ", audioFile)
-			var response string
-			_, err := fmt.Scanln(&response)
-			if err != nil {
-				fmt.Printf("Error reading input: %v\n", err)
-				return
-			}
-			if strings.ToLower(response) != "y" {
-				fmt.Println("Not overwriting - exiting")
-				return
+		err = processFile(p, cfg, absInputPath, cl.isSet("output") || cl.isSet("o"))
+	}
+	cleanup()
+	finish(err, p.interrupted.Load())
+}
+
+func processDirectory(p *pipeline, cfg utils.Config, dir string) error {
+	store := openStore(cfg)
+	defer closeStore(store)
+
+	stats, err := utils.ProcessDirectory(
+		p.ctx,
+		dir,
+		store,
+		cfg,
+		&utils.RealAudioExtractor{},
+		p.transcriber,
+		p.generator,
+		p.evaluator,
+	)
+	if errors.Is(err, utils.ErrStopped) {
+		fmt.Printf("Stopped early; progress saved to %s\n", cfg.Output)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to process directory: %v", err)
+	}
+	fmt.Printf("Transcription results saved to %s\n", cfg.Output)
+	fmt.Printf("Processed %d video(s), skipped %d\n", stats.Processed, stats.Skipped)
+	if stats.Failed > 0 {
+		fmt.Printf("%d video(s) failed; rerun with -retry-failed to retry only those\n", stats.Failed)
+	}
+	return nil
+}
+
+// processFile runs a single video and prints its result. The result is
+// only written to a results file when one was named with -o or -output.
+func processFile(p *pipeline, cfg utils.Config, videoFile string, save bool) error {
+	var store utils.ResultsStore
+	if save {
+		store = openStore(cfg)
+		defer closeStore(store)
+	}
+
+	result, err := utils.ProcessFile(
+		p.ctx,
+		videoFile,
+		store,
+		cfg,
+		&utils.RealAudioExtractor{},
+		p.transcriber,
+		p.generator,
+		p.evaluator,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to process video file: %v", err)
+	}
+	if result.AudioFile == utils.NoAudioFile {
+		return fmt.Errorf("no audio found in the video file")
+	}
+
+	fmt.Println("Transcription:", result.Transcription)
+	if len(result.Descriptions) > 0 {
+		fmt.Println("Descriptions:")
+		for _, desc := range result.Descriptions {
+			marker := ""
+			if desc.Number == result.BestDescriptionIndex {
+				marker = " (best)"
 			}
+			fmt.Printf("%d%s: %s\n", desc.Number, marker, desc.Content)
 		}
+	}
+	if save {
+		fmt.Printf("Result saved to %s\n", cfg.Output)
+	}
+	return nil
+}
 
-		extractor := &utils.RealAudioExtractor{}
-		hasAudio, err := extractor.ExtractAudio(ctx, absInputPath, audioFile)
-		if err != nil {
-			log.Fatalf("Failed to extract audio: %v", err)
+// processStream runs the video piped into stdin and writes its result as a
+// single line of JSON to out. A failed result is written too, with its
+// error, before the failure is returned.
+func processStream(p *pipeline, cfg utils.Config, name string, out io.Writer) error {
+	result, err := utils.ProcessStream(
+		p.ctx,
+		name,
+		os.Stdin,
+		cfg,
+		&utils.RealAudioExtractor{},
+		p.transcriber,
+		p.generator,
+		p.evaluator,
+	)
+	if result.VideoFile != "" {
+		if err := json.NewEncoder(out).Encode(result); err != nil {
+			return fmt.Errorf("failed to write result: %v", err)
 		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to process video stream: %v", err)
+	}
+	return nil
+}
 
-		if !hasAudio {
-			log.Fatalf("No audio found in the video file")
-		}
+// runDescribe regenerates descriptions from the transcripts in the results
+// file, optionally only for the given videos.
+func runDescribe(args []string) {
+	cl := newCommandLine("describe")
+	loadEnv()
+	cfg := cl.parse(args)
 
-		transcriber := &utils.RealAudioTranscriber{}
-		transcription, err := transcriber.TranscribeAudio(ctx, audioFile, 5*time.Minute)
-		if err != nil {
-			log.Fatalf("Failed to transcribe audio: %v", err)
-		}
+	generator, _ := newDescribers(cfg)
+	store := openStore(cfg)
+	ctx, interrupted, release := handleInterrupts()
+
+	updated, err := utils.RegenerateDescriptions(ctx, store, cfg, generator, cl.flags.Args())
+	release()
+	closeStore(store)
+	if err != nil {
+		err = fmt.Errorf("failed to generate descriptions: %v", err)
+	}
+	fmt.Printf("Generated descriptions for %d video(s); run 'evaluate' to rank them\n", updated)
+	finish(err, interrupted.Load())
+}
 
-		fmt.Println("Transcription:", transcription)
+// runEvaluate re-ranks the descriptions in the results file, optionally
+// only for the given videos.
+func runEvaluate(args []string) {
+	cl := newCommandLine("evaluate")
+	loadEnv()
+	cfg := cl.parse(args)
 
-		descriptions, err := utils.GenerateDescriptions(transcription, filepath.Base(absInputPath), *descriptionCount)
-		if err != nil {
-			log.Fatalf("Failed to generate descriptions: %v", err)
-		}
+	_, evaluator := newDescribers(cfg)
+	store := openStore(cfg)
+	ctx, interrupted, release := handleInterrupts()
 
-		fmt.Println("Descriptions:")
-		for i, desc := range descriptions {
-			fmt.Printf("%d: %s\n", i+1, desc)
-		}
+	updated, err := utils.RerankDescriptions(ctx, store, cfg, evaluator, cl.flags.Args())
+	release()
+	closeStore(store)
+	if err != nil {
+		err = fmt.Errorf("failed to evaluate descriptions: %v", err)
+	}
+	fmt.Printf("Ranked descriptions for %d video(s)\n", updated)
+	finish(err, interrupted.Load())
+}
+
+// runExport writes the results file to another file, usually in another
+// format.
+func runExport(args []string) {
+	cl := newCommandLine("export")
+	to := cl.flags.String("to", "", "File to export the results to")
+	toFormat := cl.flags.String("to-format", "", "Format of the exported file (default: from the -to extension)")
+	cfg := cl.parse(args)
+	if *to == "" {
+		log.Fatal("Usage: go run main.go export [-output <file>] -to <file> [-to-format xml|json|jsonl|sqlite]")
 	}
 
-	// Clean up .tmp directory at exit
-	cleanupTmpDir(tmpDir)
+	src := openStore(cfg)
+	defer closeStore(src)
+	dst, err := utils.NewResultsStore(*to, *toFormat)
+	if err != nil {
+		log.Fatalf("Failed to open export file: %v", err)
+	}
+	defer closeStore(dst)
+
+	exported, err := utils.ExportResults(src, dst)
+	if err != nil {
+		log.Fatalf("Failed to export results: %v", err)
+	}
+	fmt.Printf("Exported %d result(s) to %s\n", exported, *to)
 }
 
-func cleanupTmpDir(tmpDir string) {
-	files, err := os.ReadDir(tmpDir)
+// runStatus prints how many videos are done, waiting for a stage or
+// failed. Given a directory it also lists videos without a result.
+func runStatus(args []string) {
+	cl := newCommandLine("status")
+	cfg := cl.parse(args)
+
+	store := openStore(cfg)
+	defer closeStore(store)
+
+	status, err := utils.CollectStatus(store, cfg, cl.flags.Arg(0))
 	if err != nil {
-		log.Printf("Failed to read .tmp directory: %v", err)
-		return
+		log.Fatalf("Failed to collect status: %v", err)
 	}
 
-	for _, file := range files {
-		err := os.Remove(filepath.Join(tmpDir, file.Name()))
-		if err != nil {
-			log.Printf("Failed to remove file %s: %v", file.Name(), err)
+	fmt.Printf("Results in %s: %d\n", cfg.Output, status.Total)
+	fmt.Printf("  complete:              %d\n", status.Complete)
+	fmt.Printf("  needing descriptions:  %d\n", status.Transcribed)
+	fmt.Printf("  needing evaluation:    %d\n", status.Unranked)
+	fmt.Printf("  without audio:         %d\n", status.NoAudio)
+
+	stages := make([]string, 0, len(status.Failed))
+	for stage := range status.Failed {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		fmt.Printf("  failed at %-12s %d\n", stage+":", status.Failed[stage])
+	}
+
+	if cl.flags.NArg() > 0 {
+		fmt.Printf("Videos without a result: %d\n", len(status.Pending))
+		for _, video := range status.Pending {
+			fmt.Printf("  %s\n", video)
 		}
 	}
 }
+
+// runMigrate repairs a results file written by an earlier version in place.
+// The previous file is kept as a backup by the store.
+func runMigrate(args []string) {
+	cfg := newCommandLine("migrate").parse(args)
+
+	store := openStore(cfg)
+	defer closeStore(store)
+
+	changed, err := utils.MigrateResults(store)
+	if err != nil {
+		log.Fatalf("Failed to migrate results: %v", err)
+	}
+	fmt.Printf("Repaired %d result(s) in %s\n", changed, cfg.Output)
+}
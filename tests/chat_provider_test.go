@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestLocalChatProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var body struct {
+			Model    string              `json:"model"`
+			Messages []utils.ChatMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if body.Model != "llama3" {
+			t.Errorf("Expected model 'llama3', got '%s'", body.Model)
+		}
+		if len(body.Messages) != 2 {
+			t.Errorf("Expected 2 messages, got %d", len(body.Messages))
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Local reply"}}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := utils.NewLocalChatProvider(server.URL, "llama3", nil)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	reply, err := provider.CreateChatCompletion(context.Background(), utils.ChatRequest{
+		Model: "gpt-4",
+		Messages: []utils.ChatMessage{
+			{Role: utils.ChatRoleSystem, Content: "system"},
+			{Role: utils.ChatRoleUser, Content: "hello"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+	if reply != "Local reply" {
+		t.Errorf("Expected 'Local reply', got '%s'", reply)
+	}
+}
+
+func TestAnthropicChatProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("Expected API key header, got '%s'", r.Header.Get("x-api-key"))
+		}
+		var body struct {
+			System   string              `json:"system"`
+			Messages []utils.ChatMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if body.System != "system" {
+			t.Errorf("Expected system prompt 'system', got '%s'", body.System)
+		}
+		if len(body.Messages) != 1 || body.Messages[0].Role != utils.ChatRoleUser {
+			t.Errorf("Expected a single user message, got %+v", body.Messages)
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"Anthropic reply"}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := utils.NewAnthropicChatProvider("test-key", server.URL, "claude-test", nil)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	reply, err := provider.CreateChatCompletion(context.Background(), utils.ChatRequest{
+		Messages: []utils.ChatMessage{
+			{Role: utils.ChatRoleSystem, Content: "system"},
+			{Role: utils.ChatRoleUser, Content: "hello"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+	if reply != "Anthropic reply" {
+		t.Errorf("Expected 'Anthropic reply', got '%s'", reply)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestLoadConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	content := `output: project.xml
+chat:
+  provider: ollama
+  model: llama3.1
+transcription:
+  chunk_duration: 90s
+descriptions:
+  count: 5
+retry:
+  max_attempts: 2
+`
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("LLM_MODEL", "qwen2.5")
+
+	cfg, err := utils.LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.Output != "project.xml" {
+		t.Errorf("Expected output 'project.xml', got '%s'", cfg.Output)
+	}
+	if cfg.Chat.Provider != "ollama" {
+		t.Errorf("Expected provider 'ollama', got '%s'", cfg.Chat.Provider)
+	}
+	if cfg.Chat.Model != "qwen2.5" {
+		t.Errorf("Expected LLM_MODEL to override the file, got '%s'", cfg.Chat.Model)
+	}
+	if cfg.Transcription.ChunkDuration != 90*time.Second {
+		t.Errorf("Expected chunk duration 90s, got %s", cfg.Transcription.ChunkDuration)
+	}
+	if cfg.Descriptions.Count != 5 {
+		t.Errorf("Expected 5 descriptions, got %d", cfg.Descriptions.Count)
+	}
+	if cfg.Retry.MaxAttempts != 2 || cfg.Retry.MaxDelay != utils.DefaultRetryPolicy().MaxDelay {
+		t.Errorf("Expected retry attempts from file and delays from defaults, got %+v", cfg.Retry)
+	}
+	if cfg.Descriptions.MaxLength != utils.DefaultConfig().Descriptions.MaxLength {
+		t.Errorf("Expected default max description length, got %d", cfg.Descriptions.MaxLength)
+	}
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte("descriptions:\n  cuont: 5\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if _, err := utils.LoadConfig(configFile); err == nil {
+		t.Error("Expected an error for a misspelled key, got nil")
+	}
+}
+
+func TestLoadExampleConfig(t *testing.T) {
+	// The README tells users to start from this file
+	cfg, err := utils.LoadConfig(filepath.Join("..", "config.example.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed on the example config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("The example config is invalid: %v", err)
+	}
+}
+
+func TestValidateRejectsInvalidRetryPolicy(t *testing.T) {
+	for name, policy := range map[string]utils.RetryPolicy{
+		"no attempts":    {MaxAttempts: 0, BaseDelay: time.Second, MaxDelay: time.Minute},
+		"zero delay":     {MaxAttempts: 5, BaseDelay: 0, MaxDelay: time.Minute},
+		"zero max delay": {MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 0},
+		"max below base": {MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Second},
+	} {
+		cfg := utils.DefaultConfig()
+		cfg.Retry = policy
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected an error, got nil", name)
+		}
+	}
+}
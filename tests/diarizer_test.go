@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestHTTPDiarizer(t *testing.T) {
+	audioFile := filepath.Join(t.TempDir(), "talk.wav")
+	if err := os.WriteFile(audioFile, []byte("mock audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected the audio as the file field: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "talk.wav" || string(data) != "mock audio" {
+			t.Errorf("Unexpected upload %s: %q", header.Filename, data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"segments":[{"start":0,"end":2.5,"speaker":"SPEAKER_00"},{"start":2.5,"end":4,"speaker":"SPEAKER_01"}]}`))
+	}))
+	defer server.Close()
+
+	turns, err := utils.NewHTTPDiarizer(server.URL+"/diarize", nil).Diarize(context.Background(), audioFile)
+	if err != nil {
+		t.Fatalf("Diarize failed: %v", err)
+	}
+	expected := []utils.SpeakerTurn{{Start: 0, End: 2.5, Speaker: "SPEAKER_00"}, {Start: 2.5, End: 4, Speaker: "SPEAKER_01"}}
+	if !reflect.DeepEqual(turns, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, turns)
+	}
+}
+
+func TestHTTPDiarizerRetriesUpload(t *testing.T) {
+	audioFile := filepath.Join(t.TempDir(), "talk.wav")
+	if err := os.WriteFile(audioFile, []byte("mock audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The whole upload arrives on every attempt
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected the audio as the file field: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if data, _ := io.ReadAll(file); string(data) != "mock audio" {
+			t.Errorf("Unexpected upload on attempt %d: %q", calls.Load()+1, data)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"segments":[{"start":0,"end":1,"speaker":"SPEAKER_00"}]}`))
+	}))
+	defer server.Close()
+
+	turns, err := utils.NewHTTPDiarizer(server.URL, testRetryPolicy.Client()).Diarize(context.Background(), audioFile)
+	if err != nil {
+		t.Fatalf("Diarize failed: %v", err)
+	}
+	if calls.Load() != 2 || len(turns) != 1 {
+		t.Errorf("Expected success on the second attempt, got %d turns after %d attempts", len(turns), calls.Load())
+	}
+}
+
+func TestDiarizedTranscriptReachesDescriptionPrompt(t *testing.T) {
+	testDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(testDir, "collab.mp4"), []byte("mock content"), 0644); err != nil {
+		t.Fatalf("Failed to create mock file: %v", err)
+	}
+
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			return true, nil
+		},
+	}
+	transcriber := &utils.DiarizingTranscriber{
+		Transcriber: &utils.MockAudioTranscriber{
+			TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+				return utils.Transcript{
+					Text: "Hi, I'm Ana. And I'm Ben. Let's start.",
+					Segments: []utils.Segment{
+						{Start: 0, End: 2, Text: " Hi, I'm Ana."},
+						{Start: 2, End: 4, Text: " And I'm Ben."},
+						{Start: 4, End: 6, Text: " Let's start."},
+					},
+				}, nil
+			},
+		},
+		// The service's labels are arbitrary; the first voice becomes S1
+		Diarizer: &utils.MockDiarizer{
+			DiarizeFunc: func(ctx context.Context, audioFile string) ([]utils.SpeakerTurn, error) {
+				return []utils.SpeakerTurn{
+					{Start: 0, End: 2.2, Speaker: "SPEAKER_01"},
+					{Start: 2.2, End: 3.9, Speaker: "SPEAKER_00"},
+					{Start: 3.9, End: 6, Speaker: "SPEAKER_01"},
+				}, nil
+			},
+		},
+	}
+	var req utils.DescriptionRequest
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, r utils.DescriptionRequest, attempts int) ([]string, error) {
+			req = r
+			return []string{"Ana and Ben start a collab"}, nil
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = filepath.Join(testDir, "results.xml")
+	cfg.Descriptions.Count = 1
+	store, err := utils.NewResultsStore(cfg.Output, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	if _, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, generator, evaluator); err != nil {
+		t.Fatalf("ProcessDirectory failed: %v", err)
+	}
+
+	result, _, err := store.Get("collab.mp4")
+	if err != nil {
+		t.Fatalf("Failed to read result: %v", err)
+	}
+	var speakers []string
+	for _, seg := range result.Segments {
+		speakers = append(speakers, seg.Speaker)
+	}
+	if !reflect.DeepEqual(speakers, []string{"S1", "S2", "S1"}) {
+		t.Errorf("Expected speakers S1, S2, S1, got %v", speakers)
+	}
+
+	data, err := os.ReadFile(cfg.Output)
+	if err != nil {
+		t.Fatalf("Failed to read results file: %v", err)
+	}
+	if !strings.Contains(string(data), `<Segment start="0" end="2" speaker="S1">`) {
+		t.Errorf("Expected speaker attributes in the results file:\n%s", data)
+	}
+
+	if !reflect.DeepEqual(req.Speakers, []string{"S1", "S2"}) {
+		t.Errorf("Expected the generator to get speakers S1 and S2, got %v", req.Speakers)
+	}
+	expected := "S1: Hi, I'm Ana.\nS2: And I'm Ben.\nS1: Let's start."
+	if req.Transcription != expected {
+		t.Errorf("Expected the transcription by speaker:\n%s\ngot:\n%s", expected, req.Transcription)
+	}
+}
@@ -3,6 +3,7 @@ package tests
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -34,16 +35,6 @@ func TestProcessDirectory(t *testing.T) {
 		}
 	}
 
-	// Create .tmp directory
-	if err := os.MkdirAll(".tmp", os.ModePerm); err != nil {
-		t.Fatalf("Failed to create .tmp directory: %v", err)
-	}
-	defer func() {
-		if err := os.RemoveAll(".tmp"); err != nil {
-			t.Logf("Failed to remove .tmp directory: %v", err)
-		}
-	}() // Clean up after test
-
 	// Mock implementations
 	mockExtractor := &utils.MockAudioExtractor{
 		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
@@ -52,26 +43,43 @@ func TestProcessDirectory(t *testing.T) {
 		},
 	}
 	mockTranscriber := &utils.MockAudioTranscriber{
-		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration) (string, error) {
-			return "Mock transcription", nil
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{
+				Text: "Mock transcription",
+				Segments: []utils.Segment{
+					{Start: 0, End: 1.5, Text: "Mock"},
+					{Start: 1.5, End: 3, Text: "transcription"},
+				},
+			}, nil
 		},
 	}
 	mockGenerator := &utils.MockDescriptionGenerator{
-		GenerateDescriptionsFunc: func(transcription string, filename string, attempts int) ([]string, error) {
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
 			return []string{"Mock description 1", "Mock description 2"}, nil
 		},
 	}
 	mockEvaluator := &utils.MockDescriptionEvaluator{
-		EvaluateDescriptionsFunc: func(descriptions []string, transcription string, filename string) (int, error) {
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
 			return 1, nil
 		},
 	}
 
-	results, err := utils.ProcessDirectory(
+	cfg := utils.DefaultConfig()
+	cfg.Output = outputXML
+	cfg.Descriptions.Count = 2
+	cfg.Processing.SubtitleFormat = utils.SubtitleFormatSRT
+	cfg.Processing.Workers = 2
+
+	store, err := utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+
+	stats, err := utils.ProcessDirectory(
 		ctx,
 		testDir,
-		outputXML,
-		2,
+		store,
+		cfg,
 		mockExtractor,
 		mockTranscriber,
 		mockGenerator,
@@ -83,8 +91,15 @@ func TestProcessDirectory(t *testing.T) {
 
 	// Check the number of processed files
 	expectedProcessedFiles := 2 // Only .mp4 files should be processed
+	if stats.Processed != expectedProcessedFiles || stats.Failed != 0 || stats.Skipped != 0 {
+		t.Errorf("Expected %d processed files, got %+v", expectedProcessedFiles, stats)
+	}
+	results, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
 	if len(results.Results) != expectedProcessedFiles {
-		t.Errorf("Expected %d processed files, got %d", expectedProcessedFiles, len(results.Results))
+		t.Errorf("Expected %d stored results, got %d", expectedProcessedFiles, len(results.Results))
 	}
 
 	// Verify the content of the results
@@ -98,6 +113,16 @@ func TestProcessDirectory(t *testing.T) {
 		if result.BestDescriptionIndex != 1 {
 			t.Errorf("Expected best description index 1, got %d", result.BestDescriptionIndex)
 		}
+		if len(result.Segments) != 2 {
+			t.Errorf("Expected 2 segments, got %d", len(result.Segments))
+		}
+	}
+
+	// Verify a subtitle file was written next to each video
+	for _, file := range []string{"test_video1.srt", "test_video2.srt"} {
+		if _, err := os.Stat(filepath.Join(testDir, file)); err != nil {
+			t.Errorf("Expected subtitle file %s: %v", file, err)
+		}
 	}
 
 	// Verify XML output
@@ -127,11 +152,16 @@ func TestProcessDirectory(t *testing.T) {
 		},
 	}
 
+	cfg.Processing.SubtitleFormat = ""
+	store, err = utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
 	_, err = utils.ProcessDirectory(
 		ctx,
 		testDir,
-		outputXML,
-		2,
+		store,
+		cfg,
 		errorExtractor,
 		mockTranscriber,
 		mockGenerator,
@@ -142,3 +172,405 @@ func TestProcessDirectory(t *testing.T) {
 		t.Error("Expected an error when audio extraction fails, got nil")
 	}
 }
+
+func TestProcessDirectoryKeepGoing(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+	outputXML := filepath.Join(testDir, "test_output.xml")
+
+	for _, file := range []string{"good.mp4", "corrupt.mkv"} {
+		if err := os.WriteFile(filepath.Join(testDir, file), []byte("mock content"), 0644); err != nil {
+			t.Fatalf("Failed to create mock file %s: %v", file, err)
+		}
+	}
+
+	extractCalls := make(map[string]int)
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			extractCalls[filepath.Base(videoFile)]++
+			if filepath.Base(videoFile) == "corrupt.mkv" && extractCalls["corrupt.mkv"] == 1 {
+				return false, os.ErrInvalid
+			}
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			return []string{"Mock description"}, nil
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = outputXML
+	cfg.Descriptions.Count = 1
+	cfg.Processing.KeepGoing = true
+	store, err := utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	stats, err := utils.ProcessDirectory(ctx, testDir, store, cfg, extractor, transcriber, generator, evaluator)
+	if err != nil {
+		t.Fatalf("ProcessDirectory failed despite KeepGoing: %v", err)
+	}
+	if stats.Processed != 2 || stats.Failed != 1 {
+		t.Fatalf("Expected 2 processed videos with 1 failure, got %+v", stats)
+	}
+
+	xmlContent, err := os.ReadFile(outputXML)
+	if err != nil {
+		t.Fatalf("Failed to read output XML: %v", err)
+	}
+	var parsedResults utils.TranscriptionResults
+	if err := xml.Unmarshal(xmlContent, &parsedResults); err != nil {
+		t.Fatalf("Failed to parse output XML: %v", err)
+	}
+	for _, result := range parsedResults.Results {
+		switch result.VideoFile {
+		case "corrupt.mkv":
+			if result.Error == nil || result.Error.Stage != utils.StageExtract {
+				t.Errorf("Expected an extract error for corrupt.mkv, got %+v", result.Error)
+			}
+		case "good.mp4":
+			if result.Error != nil {
+				t.Errorf("Expected no error for good.mp4, got %+v", result.Error)
+			}
+		}
+	}
+
+	// A second run only retries the failed video
+	cfg.Processing.RetryFailedOnly = true
+	store, err = utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	stats, err = utils.ProcessDirectory(ctx, testDir, store, cfg, extractor, transcriber, generator, evaluator)
+	if err != nil {
+		t.Fatalf("Retry run failed: %v", err)
+	}
+	if extractCalls["good.mp4"] != 1 || extractCalls["corrupt.mkv"] != 2 {
+		t.Errorf("Expected only corrupt.mkv to be retried, got calls %v", extractCalls)
+	}
+	if stats.Processed != 1 || stats.Failed != 0 || stats.Skipped != 1 {
+		t.Errorf("Expected 1 retried and 1 skipped video, got %+v", stats)
+	}
+	results, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, result := range results.Results {
+		if result.Error != nil {
+			t.Errorf("Expected no errors after retry, got %+v for %s", result.Error, result.VideoFile)
+		}
+	}
+}
+
+func TestProcessDirectorySavesOtherWorkersAfterFailure(t *testing.T) {
+	testDir := t.TempDir()
+	outputXML := filepath.Join(testDir, "test_output.xml")
+	for _, file := range []string{"good.mp4", "bad.mp4"} {
+		if err := os.WriteFile(filepath.Join(testDir, file), []byte("mock content "+file), 0644); err != nil {
+			t.Fatalf("Failed to create mock file %s: %v", file, err)
+		}
+	}
+
+	// bad.mp4 fails while good.mp4 is in its last stage, which completes
+	// after the failure has cancelled the run
+	evaluating := make(chan struct{})
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			if filepath.Base(videoFile) == "bad.mp4" {
+				<-evaluating
+				return false, os.ErrInvalid
+			}
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			return []string{"Mock description"}, nil
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			close(evaluating)
+			<-ctx.Done()
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = outputXML
+	cfg.Descriptions.Count = 1
+	cfg.Processing.Workers = 2
+	store, err := utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	if _, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, generator, evaluator); err == nil {
+		t.Fatal("Expected the failure of bad.mp4 to be returned")
+	}
+
+	good, ok, err := store.Get("good.mp4")
+	if err != nil || !ok {
+		t.Fatalf("Expected good.mp4 to be saved: ok=%v err=%v", ok, err)
+	}
+	if good.Error != nil || good.BestDescriptionIndex != 1 {
+		t.Errorf("Expected a finished result for good.mp4, got %+v", good)
+	}
+	if _, ok, _ := store.Get("bad.mp4"); ok {
+		t.Error("Expected no result for bad.mp4 without keep-going")
+	}
+}
+
+func TestProcessDirectoryFollowsMovedAndChangedVideos(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+	outputXML := filepath.Join(t.TempDir(), "results.xml")
+
+	for file, content := range map[string]string{"keep.mp4": "same cut", "move.mp4": "moved cut", "recut.mp4": "first cut"} {
+		if err := os.WriteFile(filepath.Join(testDir, file), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create mock file %s: %v", file, err)
+		}
+	}
+
+	extractCalls := make(map[string]int)
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			extractCalls[filepath.Base(videoFile)]++
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			return []string{"Mock description"}, nil
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = outputXML
+	cfg.Descriptions.Count = 1
+	run := func() utils.TranscriptionResults {
+		store, err := utils.NewResultsStore(outputXML, "")
+		if err != nil {
+			t.Fatalf("Failed to open results store: %v", err)
+		}
+		if _, err := utils.ProcessDirectory(ctx, testDir, store, cfg, extractor, transcriber, generator, evaluator); err != nil {
+			t.Fatalf("ProcessDirectory failed: %v", err)
+		}
+		results, err := store.Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return results
+	}
+
+	for _, result := range run().Results {
+		if result.Source == nil || result.Source.Hash == "" {
+			t.Fatalf("Expected a fingerprint on %s", result.VideoFile)
+		}
+	}
+
+	// Move one video into a subdirectory and replace another with a new cut
+	if err := os.MkdirAll(filepath.Join(testDir, "archive"), 0750); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	if err := os.Rename(filepath.Join(testDir, "move.mp4"), filepath.Join(testDir, "archive", "moved.mp4")); err != nil {
+		t.Fatalf("Failed to move video: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "recut.mp4"), []byte("second, longer cut"), 0644); err != nil {
+		t.Fatalf("Failed to replace video: %v", err)
+	}
+	// Touching a file without changing it must not trigger a reprocess
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(testDir, "keep.mp4"), later, later); err != nil {
+		t.Fatalf("Failed to touch video: %v", err)
+	}
+
+	results := run()
+	if extractCalls["keep.mp4"] != 1 || extractCalls["move.mp4"] != 1 || extractCalls["moved.mp4"] != 0 || extractCalls["recut.mp4"] != 2 {
+		t.Errorf("Expected only recut.mp4 to be reprocessed, got calls %v", extractCalls)
+	}
+
+	paths := make(map[string]bool)
+	for _, result := range results.Results {
+		paths[result.VideoFile] = true
+	}
+	if len(paths) != 3 || !paths["archive/moved.mp4"] || paths["move.mp4"] {
+		t.Errorf("Expected the moved result to follow its video, got %v", paths)
+	}
+}
+
+func TestProcessDirectoryStageTimeout(t *testing.T) {
+	testDir := t.TempDir()
+	outputXML := filepath.Join(testDir, "test_output.xml")
+	if err := os.WriteFile(filepath.Join(testDir, "slow.mp4"), []byte("mock content"), 0644); err != nil {
+		t.Fatalf("Failed to create mock file: %v", err)
+	}
+
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	// The generator only returns once its context is done, like a chat call
+	// that never answers
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = outputXML
+	cfg.Processing.KeepGoing = true
+	cfg.Timeouts.Generate = 50 * time.Millisecond
+	store, err := utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	stats, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, generator, evaluator)
+	if err != nil {
+		t.Fatalf("ProcessDirectory failed despite KeepGoing: %v", err)
+	}
+	if stats.Failed != 1 {
+		t.Fatalf("Expected 1 failed video, got %+v", stats)
+	}
+	result, ok, err := store.Get("slow.mp4")
+	if err != nil || !ok {
+		t.Fatalf("Get failed: ok=%v err=%v", ok, err)
+	}
+	if result.Error == nil || result.Error.Stage != utils.StageGenerate {
+		t.Errorf("Expected a generate error after the timeout, got %+v", result.Error)
+	}
+	if result.Transcription != "Mock transcription" {
+		t.Errorf("Expected the transcription to be kept, got %q", result.Transcription)
+	}
+
+	// Cancelling the run's context reaches the generator as well
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg.Timeouts.Generate = 0
+	if _, err := utils.ProcessDirectory(ctx, testDir, store, cfg, extractor, transcriber, generator, evaluator); err == nil {
+		t.Error("Expected a cancelled run to fail")
+	}
+}
+
+func TestProcessDirectoryGracefulStop(t *testing.T) {
+	testDir := t.TempDir()
+	outputXML := filepath.Join(testDir, "test_output.xml")
+	for _, file := range []string{"a.mp4", "b.mp4"} {
+		if err := os.WriteFile(filepath.Join(testDir, file), []byte("mock content "+file), 0644); err != nil {
+			t.Fatalf("Failed to create mock file %s: %v", file, err)
+		}
+	}
+
+	ctx, stop := utils.WithGracefulStop(context.Background())
+	defer stop()
+
+	extracted := make(map[string]int)
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			extracted[filepath.Base(videoFile)]++
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	generated := 0
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			generated++
+			// The interrupt arrives while the first video is being described
+			stop()
+			if ctx.Err() != nil {
+				t.Error("A graceful stop must not cancel the running stage")
+			}
+			return []string{"Mock description"}, nil
+		},
+	}
+	evaluated := 0
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			evaluated++
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = outputXML
+	cfg.Descriptions.Count = 1
+	store, err := utils.NewResultsStore(outputXML, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	if _, err := utils.ProcessDirectory(ctx, testDir, store, cfg, extractor, transcriber, generator, evaluator); !errors.Is(err, utils.ErrStopped) {
+		t.Fatalf("Expected ErrStopped, got %v", err)
+	}
+	if evaluated != 0 || len(extracted) != 1 {
+		t.Fatalf("Expected no further stage or video after the stop, got %d evaluations and extractions %v", evaluated, extracted)
+	}
+
+	saved, ok, err := store.Get("a.mp4")
+	if err != nil || !ok {
+		t.Fatalf("Expected the stopped video to be saved: ok=%v err=%v", ok, err)
+	}
+	if saved.Error != nil || len(saved.Descriptions) != 1 || saved.BestDescriptionIndex != 0 {
+		t.Errorf("Expected unranked descriptions without an error, got %+v", saved)
+	}
+
+	// The next run picks up where the stopped one left off
+	if _, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, generator, evaluator); err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+	results, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if extracted["a.mp4"] != 1 || generated != 2 || evaluated != 2 {
+		t.Errorf("Expected a.mp4 to resume at evaluation, got extractions %v, %d generations, %d evaluations", extracted, generated, evaluated)
+	}
+	for _, result := range results.Results {
+		if result.BestDescriptionIndex != 1 {
+			t.Errorf("Expected %s to be ranked, got %+v", result.VideoFile, result)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestProcessFileEvaluatesAndPersists(t *testing.T) {
+	videoFile := filepath.Join(t.TempDir(), "single.mp4")
+	if err := os.WriteFile(videoFile, []byte("mock content"), 0644); err != nil {
+		t.Fatalf("Failed to create mock file: %v", err)
+	}
+	output := filepath.Join(t.TempDir(), "single.json")
+
+	extractCalls := 0
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			extractCalls++
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			return []string{"First", "Second"}, nil
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 2, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Descriptions.Count = 2
+	for run := 0; run < 2; run++ {
+		store, err := utils.NewResultsStore(output, "")
+		if err != nil {
+			t.Fatalf("Failed to open results store: %v", err)
+		}
+		result, err := utils.ProcessFile(context.Background(), videoFile, store, cfg, extractor, transcriber, generator, evaluator)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		if result.VideoFile != "single.mp4" || result.BestDescriptionIndex != 2 || len(result.Descriptions) != 2 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+
+		stored, ok, err := store.Get("single.mp4")
+		if err != nil || !ok {
+			t.Fatalf("Expected the result to be saved: ok=%v err=%v", ok, err)
+		}
+		if stored.Source == nil || stored.BestDescriptionIndex != 2 {
+			t.Errorf("Saved result is incomplete: %+v", stored)
+		}
+	}
+	if extractCalls != 1 {
+		t.Errorf("Expected the saved result to be resumed on the second run, got %d extractions", extractCalls)
+	}
+
+	// Without a store nothing is written
+	if _, err := utils.ProcessFile(context.Background(), videoFile, nil, cfg, extractor, transcriber, generator, evaluator); err != nil {
+		t.Fatalf("ProcessFile without store failed: %v", err)
+	}
+	if extractCalls != 2 {
+		t.Errorf("Expected a fresh run without a store, got %d extractions", extractCalls)
+	}
+}
+
+func TestProcessStream(t *testing.T) {
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			// The stream arrives as a seekable file
+			content, err := os.ReadFile(videoFile)
+			if err != nil || string(content) != "mock video" {
+				t.Errorf("Expected the extractor to read a copy of the stream, got %q (%v)", content, err)
+			}
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			if req.Filename != "upload.mp4" {
+				t.Errorf("Expected the stream name as filename, got %q", req.Filename)
+			}
+			return []string{"Only"}, nil
+		},
+	}
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 1, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Descriptions.Count = 1
+	result, err := utils.ProcessStream(context.Background(), "upload.mp4", strings.NewReader("mock video"), cfg, extractor, transcriber, generator, evaluator)
+	if err != nil {
+		t.Fatalf("ProcessStream failed: %v", err)
+	}
+	if result.VideoFile != "upload.mp4" || result.BestDescriptionIndex != 1 || result.Source != nil {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// A failed stream still yields a result recording the error
+	transcriber.TranscribeAudioFunc = func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+		return utils.Transcript{}, errors.New("service unavailable")
+	}
+	result, err = utils.ProcessStream(context.Background(), "upload.mp4", strings.NewReader("mock video"), cfg, extractor, transcriber, generator, evaluator)
+	if err == nil {
+		t.Fatal("Expected the failed transcription to be returned")
+	}
+	if result.VideoFile != "upload.mp4" || result.Error == nil || result.Error.Stage != utils.StageTranscribe {
+		t.Errorf("Expected a result with a transcribe error, got %+v", result)
+	}
+}
+
+func TestRealAudioExtractorReadsStdin(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available")
+	}
+
+	// Produce a short clip as a stream, the way object storage would
+	clip := exec.Command("ffmpeg", "-f", "lavfi", "-i", "sine=frequency=440:sample_rate=16000", "-t", "1", "-f", "wav", "-")
+	stream, err := clip.Output()
+	if err != nil {
+		t.Fatalf("Failed to create test stream: %v", err)
+	}
+
+	audioFile := filepath.Join(t.TempDir(), "stream.wav")
+	extractor := utils.RealAudioExtractor{Stdin: bytes.NewReader(stream)}
+	hasAudio, err := extractor.ExtractAudio(context.Background(), utils.StdinInput, audioFile)
+	if err != nil {
+		t.Fatalf("ExtractAudio failed: %v", err)
+	}
+	if !hasAudio {
+		t.Error("Expected the stream to have audio")
+	}
+	if info, err := os.Stat(audioFile); err != nil || info.Size() == 0 {
+		t.Errorf("Expected extracted audio at %s: %v", audioFile, err)
+	}
+}
+
+func TestRealAudioExtractorRunsFFmpegInItsOwnProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("needs /proc to read process groups")
+	}
+	dir := t.TempDir()
+	idsFile := filepath.Join(dir, "ids")
+	// Fields 1 and 5 of /proc/<pid>/stat are the process and group IDs
+	writeScript(t, filepath.Join(dir, "ffmpeg"), `read -r pid comm state ppid pgrp rest < /proc/$$/stat
+echo "$pid $pgrp" > `+idsFile+"\n")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	extractor := utils.RealAudioExtractor{}
+	if _, err := extractor.ExtractAudio(context.Background(), "video.mp4", filepath.Join(dir, "audio.wav")); err != nil {
+		t.Fatalf("ExtractAudio failed: %v", err)
+	}
+	ids, err := os.ReadFile(idsFile)
+	if err != nil {
+		t.Fatalf("Failed to read process IDs: %v", err)
+	}
+	fields := strings.Fields(string(ids))
+	if len(fields) != 2 || fields[0] != fields[1] {
+		t.Errorf("Expected ffmpeg to lead its own process group, got pid and group %v", fields)
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestGlossaryCorrect(t *testing.T) {
+	g := utils.Glossary{Corrections: map[string]string{
+		"Huge Frog":    "HugeFrog24",
+		"Huge Frog 24": "HugeFrog24",
+		"ne":           "'ne",
+	}}
+	got := g.Correct("Huge Frog 24 hat ne neue Idee, sagt Huge Frog.")
+	expected := "HugeFrog24 hat 'ne neue Idee, sagt HugeFrog24."
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	// A longer correction ending inside a word gives way to a shorter one
+	g = utils.Glossary{Corrections: map[string]string{
+		"Huge Frog 2": "Huge Frog Two",
+		"Huge Frog":   "HugeFrog",
+	}}
+	if got := g.Correct("Huge Frog 24"); got != "HugeFrog 24" {
+		t.Errorf("Expected %q, got %q", "HugeFrog 24", got)
+	}
+}
+
+func TestGlossaryPrompt(t *testing.T) {
+	g := utils.Glossary{Terms: []string{"HugeFrog24", "Schnitzelbrötchen"}}
+	if prompt := g.Prompt(); prompt != "HugeFrog24, Schnitzelbrötchen" {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+
+	long := utils.Glossary{Terms: []string{strings.Repeat("a", 700), strings.Repeat("b", 200)}}
+	if prompt := long.Prompt(); prompt != strings.Repeat("a", 700) {
+		t.Errorf("Expected terms beyond the limit to be left out, got %d characters", len(prompt))
+	}
+}
+
+func TestProcessDirectoryUsesGlossaries(t *testing.T) {
+	testDir := t.TempDir()
+	writeFile := func(name, content string) {
+		path := filepath.Join(testDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	writeFile("intro.mp4", "intro")
+	writeFile("collabs/ben.mp4", "ben")
+	writeFile(utils.GlossaryFileName, "terms: [HugeFrog24]\ncorrections:\n  Huge Frog: HugeFrog24\n")
+	writeFile("collabs/"+utils.GlossaryFileName, "terms: [BenBuilds]\ncorrections:\n  Huge Frog: HugeFrog24 & Ben\n  Ben Builds: BenBuilds\n")
+
+	global := filepath.Join(t.TempDir(), "glossary.yaml")
+	if err := os.WriteFile(global, []byte("terms: [Schnitzelbrötchen]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write global glossary: %v", err)
+	}
+
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			return true, nil
+		},
+	}
+	var mu sync.Mutex
+	prompts := make(map[string]string)
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			prompts[strings.SplitN(filepath.Base(audioFile), "_", 2)[0]] = prompt
+			return utils.Transcript{
+				Text:     "Huge Frog and Ben Builds",
+				Segments: []utils.Segment{{Start: 0, End: 2, Text: "Huge Frog and Ben Builds"}},
+			}, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = filepath.Join(t.TempDir(), "results.xml")
+	cfg.Glossary = global
+	store, err := utils.NewResultsStore(cfg.Output, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	if _, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, nil, nil); err != nil {
+		t.Fatalf("ProcessDirectory failed: %v", err)
+	}
+
+	if prompts["intro"] != "Schnitzelbrötchen, HugeFrog24" {
+		t.Errorf("Unexpected prompt for intro.mp4: %q", prompts["intro"])
+	}
+	if prompts["ben"] != "Schnitzelbrötchen, HugeFrog24, BenBuilds" {
+		t.Errorf("Unexpected prompt for collabs/ben.mp4: %q", prompts["ben"])
+	}
+
+	expected := map[string]string{
+		"intro.mp4":       "HugeFrog24 and Ben Builds",
+		"collabs/ben.mp4": "HugeFrog24 & Ben and BenBuilds",
+	}
+	for video, text := range expected {
+		result, _, err := store.Get(video)
+		if err != nil {
+			t.Fatalf("Failed to read result: %v", err)
+		}
+		if result.Transcription != text || len(result.Segments) != 1 || result.Segments[0].Text != text {
+			t.Errorf("Expected %s to be corrected to %q, got %+v", video, text, result)
+		}
+	}
+}
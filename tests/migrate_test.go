@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestMigrateResultsRepairsDoubleEscaping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+
+	// What earlier versions wrote: escaped once by hand, once by the encoder
+	legacy := `<TranscriptionResults>
+  <TranscriptionResult>
+    <VideoFile>video.mp4</VideoFile>
+    <AudioFile>.tmp/video.wav</AudioFile>
+    <Transcription>Los geht&amp;#39;s!</Transcription>
+    <Segments>
+      <Segment start="0" end="1">Los geht&amp;#39;s!</Segment>
+    </Segments>
+    <Descriptions>
+      <Description number="1">Der &amp;#34;beste&amp;#34; Streich &amp;amp; mehr</Description>
+    </Descriptions>
+    <BestDescriptionIndex>1</BestDescriptionIndex>
+  </TranscriptionResult>
+  <TranscriptionResult>
+    <VideoFile>clean.mp4</VideoFile>
+    <AudioFile>.tmp/clean.wav</AudioFile>
+    <Transcription>Nothing to repair</Transcription>
+    <Descriptions></Descriptions>
+    <BestDescriptionIndex>0</BestDescriptionIndex>
+  </TranscriptionResult>
+</TranscriptionResults>`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatalf("Failed to write legacy results: %v", err)
+	}
+
+	store, err := utils.NewResultsStore(path, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	changed, err := utils.MigrateResults(store)
+	if err != nil {
+		t.Fatalf("MigrateResults failed: %v", err)
+	}
+	if changed != 1 {
+		t.Errorf("Expected 1 repaired result, got %d", changed)
+	}
+
+	result, _, err := store.Get("video.mp4")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if result.Transcription != "Los geht's!" || result.Segments[0].Text != "Los geht's!" {
+		t.Errorf("Transcription not repaired: %q / %q", result.Transcription, result.Segments[0].Text)
+	}
+	if result.Descriptions[0].Content != `Der "beste" Streich & mehr` {
+		t.Errorf("Description not repaired: %q", result.Descriptions[0].Content)
+	}
+
+	// The file is now escaped exactly once
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	if strings.Contains(string(content), "&amp;#") {
+		t.Errorf("Results file is still double-escaped:\n%s", content)
+	}
+	if !strings.Contains(string(content), `<TranscriptionResults version="1">`) {
+		t.Errorf("Expected the format version to be recorded:\n%s", content)
+	}
+
+	// A second run has nothing left to do
+	changed, err = utils.MigrateResults(store)
+	if err != nil || changed != 0 {
+		t.Errorf("Expected nothing to repair on the second run, got %d (%v)", changed, err)
+	}
+}
+
+func TestMigrateResultsSkipsCurrentFormat(t *testing.T) {
+	// An entity name in the text of current results is meant literally
+	html := utils.TranscriptionResult{
+		VideoFile:     "html.mp4",
+		Transcription: "Write &amp;lt; for a less-than sign",
+	}
+	for _, file := range []string{"results.xml", "results.json", "results.db"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file)
+
+			store, err := utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			if err := store.Put(html); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			store, err = utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to reopen store: %v", err)
+			}
+			defer func() { _ = store.Close() }()
+			if version, err := store.FormatVersion(); err != nil || version != utils.ResultsFormatVersion {
+				t.Errorf("Expected a new store to be at version %d, got %d (%v)", utils.ResultsFormatVersion, version, err)
+			}
+			changed, err := utils.MigrateResults(store)
+			if err != nil || changed != 0 {
+				t.Errorf("Expected nothing to migrate, got %d (%v)", changed, err)
+			}
+			result, _, err := store.Get("html.mp4")
+			if err != nil || result.Transcription != html.Transcription {
+				t.Errorf("Expected the transcription to stay %q, got %q (%v)", html.Transcription, result.Transcription, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestPersonaFor(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.Persona = "main"
+	cfg.Personas = map[string]utils.Persona{
+		"main":  {ChannelName: "HugeFrog24"},
+		"guest": {ChannelName: "GuestChannel", Perspective: utils.PerspectiveThirdPerson},
+		"live":  {ChannelName: "HugeFrog24 Live"},
+	}
+	cfg.PersonaDirs = map[string]string{
+		"collabs":         "guest",
+		"collabs/streams": "live",
+	}
+
+	tests := map[string]string{
+		"vlog.mp4":                      "HugeFrog24",
+		"collabs/episode1.mp4":          "GuestChannel",
+		"collabs/streams/stream1.mp4":   "HugeFrog24 Live",
+		"collabs-archive/episode1.mp4":  "HugeFrog24",
+		"other/collabs/not-nested1.mp4": "HugeFrog24",
+	}
+	for relativePath, expected := range tests {
+		persona, err := cfg.PersonaFor(relativePath)
+		if err != nil {
+			t.Fatalf("PersonaFor(%s) failed: %v", relativePath, err)
+		}
+		if persona.ChannelName != expected {
+			t.Errorf("PersonaFor(%s): expected '%s', got '%s'", relativePath, expected, persona.ChannelName)
+		}
+	}
+}
+
+func TestDescriptionGeneratorUsesPersona(t *testing.T) {
+	var systemPrompt string
+	provider := &utils.MockChatProvider{
+		CreateChatCompletionFunc: func(ctx context.Context, req utils.ChatRequest) (string, error) {
+			systemPrompt = req.Messages[0].Content
+			return "A description", nil
+		},
+	}
+
+	prompts, err := utils.LoadPrompts("")
+	if err != nil {
+		t.Fatalf("Failed to load prompts: %v", err)
+	}
+
+	generator := utils.NewRealDescriptionGenerator(provider, prompts, utils.DefaultConfig())
+	_, err = generator.GenerateDescriptions(context.Background(), utils.DescriptionRequest{
+		Transcription: "Hallo und herzlich willkommen zu diesem Video",
+		Filename:      "video.mp4",
+		Persona: utils.Persona{
+			ChannelName: "GuestChannel",
+			Perspective: utils.PerspectiveThirdPerson,
+			Tone:        "playful",
+			Vocabulary:  []string{"Schmackes"},
+		},
+	}, 1)
+	if err != nil {
+		t.Fatalf("GenerateDescriptions failed: %v", err)
+	}
+
+	for _, expected := range []string{"third person", "GuestChannel", "playful", "'Schmackes'"} {
+		if !strings.Contains(systemPrompt, expected) {
+			t.Errorf("Expected system prompt to contain '%s', got: %s", expected, systemPrompt)
+		}
+	}
+	if strings.Contains(systemPrompt, "HugeFrog24") {
+		t.Errorf("System prompt still mentions HugeFrog24: %s", systemPrompt)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestDefaultPrompts(t *testing.T) {
+	prompts, err := utils.LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts failed: %v", err)
+	}
+
+	data := utils.PromptData{
+		Language:      "German",
+		Filename:      "vlog.mp4",
+		Transcription: "Hallo",
+		MaxLength:     1000,
+		Persona:       utils.Persona{ChannelName: "HugeFrog24"},
+		Descriptions:  []string{"First", "Second"},
+	}
+
+	system, err := prompts.Render(utils.PromptDescriptionSystem, data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	expected := "You are a helpful assistant that generates clear and concise descriptions for videos in German. Ensure the description is in the same language as the transcription. Write the description from the perspective of the creator (HugeFrog24). Correct any misrecognitions of 'HugeFrog24'. Use the filename to infer additional context about the video's content or theme, as it may contain relevant keywords or information not present in the transcription."
+	if system != expected {
+		t.Errorf("Unexpected description system prompt:\n%s\nexpected:\n%s", system, expected)
+	}
+
+	user, err := prompts.Render(utils.PromptDescriptionUser, data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	expected = "Based on the following transcription and filename, generate a clear and concise description for the video (maximum 1000 characters).\n\nFilename: vlog.mp4\n\nTranscription:\nHallo"
+	if user != expected {
+		t.Errorf("Unexpected description user prompt:\n%q\nexpected:\n%q", user, expected)
+	}
+
+	evaluation, err := prompts.Render(utils.PromptEvaluationUser, data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	expectedTail := "Descriptions:\n1. First\n\n2. Second\n\n\nRemember, respond with ONLY the number of the best description, nothing else."
+	if len(evaluation) < len(expectedTail) || evaluation[len(evaluation)-len(expectedTail):] != expectedTail {
+		t.Errorf("Unexpected evaluation prompt ending:\n%q", evaluation)
+	}
+}
+
+func TestPromptOverrides(t *testing.T) {
+	dir := t.TempDir()
+	override := "Beschreibe {{.Filename}} in höchstens {{.MaxLength}} Zeichen."
+	if err := os.WriteFile(filepath.Join(dir, utils.PromptDescriptionUser), []byte(override), 0600); err != nil {
+		t.Fatalf("Failed to write override: %v", err)
+	}
+
+	prompts, err := utils.LoadPrompts(dir)
+	if err != nil {
+		t.Fatalf("LoadPrompts failed: %v", err)
+	}
+
+	user, err := prompts.Render(utils.PromptDescriptionUser, utils.PromptData{Filename: "vlog.mp4", MaxLength: 500})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if user != "Beschreibe vlog.mp4 in höchstens 500 Zeichen." {
+		t.Errorf("Override not used, got: %s", user)
+	}
+
+	// Templates without an override keep the built-in text
+	system, err := prompts.Render(utils.PromptSummarySystem, utils.PromptData{Language: "German"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if system != "You are a helpful assistant that summarizes text concisely while retaining key information. Always respond in German." {
+		t.Errorf("Unexpected summary system prompt: %s", system)
+	}
+}
+
+func TestPromptOverrideSyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, utils.PromptSummaryUser), []byte("{{.Text"), 0600); err != nil {
+		t.Fatalf("Failed to write override: %v", err)
+	}
+
+	if _, err := utils.LoadPrompts(dir); err == nil {
+		t.Error("Expected an error for a broken template, got nil")
+	}
+}
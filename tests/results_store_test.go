@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+var storeTestResults = []utils.TranscriptionResult{
+	{
+		VideoFile:     "vlogs/first.mp4",
+		AudioFile:     ".tmp/first.wav",
+		Transcription: "Hallo \"Welt\" & <Freunde>",
+		Segments:      []utils.Segment{{Start: 0, End: 1.5, Speaker: "S1", Text: "Hallo"}, {Start: 1.5, End: 2, Text: "Welt"}},
+		Descriptions: []utils.Description{
+			{Number: 1, Content: "It's the first video"},
+			{Number: 2, Content: "Another take"},
+		},
+		BestDescriptionIndex: 2,
+		Source:               &utils.Fingerprint{Size: 42, ModTime: time.Date(2024, 5, 1, 12, 30, 0, 500, time.UTC), Hash: "abc123"},
+	},
+	{
+		VideoFile: "broken.mkv",
+		Error:     &utils.ProcessingError{Stage: utils.StageExtract, Message: "ffmpeg error"},
+	},
+}
+
+func TestResultsStoreFormats(t *testing.T) {
+	for _, file := range []string{"results.xml", "results.json", "results.jsonl", "results.db"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file)
+
+			store, err := utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			for _, result := range storeTestResults {
+				if err := store.Put(result); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			// Replacing a result must not leave stale descriptions behind
+			updated := storeTestResults[0]
+			updated.Descriptions = updated.Descriptions[:1]
+			updated.BestDescriptionIndex = 1
+			if err := store.Put(updated); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			// Reopen to make sure everything went through the file
+			store, err = utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to reopen store: %v", err)
+			}
+			defer func() { _ = store.Close() }()
+			results, err := store.Load()
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if len(results.Results) != len(storeTestResults) {
+				t.Fatalf("Expected %d results, got %d", len(storeTestResults), len(results.Results))
+			}
+
+			first, ok, err := store.Get("vlogs/first.mp4")
+			if err != nil || !ok {
+				t.Fatalf("Get failed: ok=%v err=%v", ok, err)
+			}
+			if first.Transcription != storeTestResults[0].Transcription {
+				t.Errorf("Expected transcription %q, got %q", storeTestResults[0].Transcription, first.Transcription)
+			}
+			if len(first.Descriptions) != 1 || first.Descriptions[0].Content != "It's the first video" {
+				t.Errorf("Descriptions did not round-trip: %+v", first.Descriptions)
+			}
+			if !reflect.DeepEqual(first.Segments, storeTestResults[0].Segments) {
+				t.Errorf("Segments did not round-trip: %+v", first.Segments)
+			}
+			if first.Source == nil || !first.Source.ModTime.Equal(storeTestResults[0].Source.ModTime) || first.Source.Hash != "abc123" {
+				t.Errorf("Fingerprint did not round-trip: %+v", first.Source)
+			}
+
+			broken, ok, err := store.Get("broken.mkv")
+			if err != nil || !ok {
+				t.Fatalf("Get failed: ok=%v err=%v", ok, err)
+			}
+			if broken.Error == nil || broken.Error.Stage != utils.StageExtract {
+				t.Errorf("Error did not round-trip: %+v", broken.Error)
+			}
+
+			sources, err := store.Sources()
+			if err != nil {
+				t.Fatalf("Sources failed: %v", err)
+			}
+			if len(sources) != 1 || !sources["vlogs/first.mp4"].ModTime.Equal(storeTestResults[0].Source.ModTime) || sources["vlogs/first.mp4"].Hash != "abc123" {
+				t.Errorf("Expected only the fingerprint of vlogs/first.mp4, got %+v", sources)
+			}
+			found, err := store.FindByHash("abc123")
+			if err != nil {
+				t.Fatalf("FindByHash failed: %v", err)
+			}
+			if len(found) != 1 || found[0].VideoFile != "vlogs/first.mp4" || len(found[0].Descriptions) != 1 {
+				t.Errorf("Expected vlogs/first.mp4 by its hash, got %+v", found)
+			}
+
+			if err := store.Delete("broken.mkv"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, ok, _ := store.Get("broken.mkv"); ok {
+				t.Error("Expected broken.mkv to be deleted")
+			}
+			if _, ok, _ := store.Get("vlogs/first.mp4"); !ok {
+				t.Error("Delete removed the wrong result")
+			}
+		})
+	}
+}
+
+func TestJSONLStoreWritesOneResultPerLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.out")
+
+	store, err := utils.NewResultsStore(path, utils.FormatJSONL)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, result := range storeTestResults {
+		if err := store.Put(result); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != len(storeTestResults) {
+		t.Errorf("Expected %d lines, got %d", len(storeTestResults), len(lines))
+	}
+	if !strings.HasPrefix(lines[0], `{"video_file":"vlogs/first.mp4"`) {
+		t.Errorf("Unexpected first line: %s", lines[0])
+	}
+}
+
+func TestFileStoreKeepsBackupOfPreviousWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+
+	store, err := utils.NewResultsStore(path, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, result := range storeTestResults {
+		if err := store.Put(result); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	backup, err := os.ReadFile(utils.BackupPath(path))
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if !strings.Contains(string(backup), "vlogs/first.mp4") || strings.Contains(string(backup), "broken.mkv") {
+		t.Errorf("Backup should hold the results before the last Put:\n%s", backup)
+	}
+
+	// No temporary files may be left next to the results
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected only the results file and its backup, got %d entries", len(entries))
+	}
+}
+
+func TestFileStoreKeepsFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not meaningful on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "results.xml")
+
+	store, err := utils.NewResultsStore(path, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := store.Put(storeTestResults[0]); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat results: %v", err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected a new results file to be 0644, got %v", info.Mode().Perm())
+	}
+
+	// A mode chosen by the user survives rewrites
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatalf("Failed to change mode: %v", err)
+	}
+	if err := store.Put(storeTestResults[1]); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat results: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the results file to stay 0640, got %v", info.Mode().Perm())
+	}
+}
+
+func TestFileStoreRecoversTruncatedFile(t *testing.T) {
+	for _, file := range []string{"results.xml", "results.json", "results.jsonl"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file)
+
+			store, err := utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			for _, result := range storeTestResults {
+				if err := store.Put(result); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			// Simulate a crash halfway through writing the second result
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read results: %v", err)
+			}
+			cut := strings.Index(string(content), "broken.mkv")
+			if err := os.WriteFile(path, content[:cut], 0600); err != nil {
+				t.Fatalf("Failed to truncate results: %v", err)
+			}
+			if err := os.Remove(utils.BackupPath(path)); err != nil {
+				t.Fatalf("Failed to remove backup: %v", err)
+			}
+
+			store, err = utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to reopen damaged store: %v", err)
+			}
+			results, err := store.Load()
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if len(results.Results) != 1 || results.Results[0].VideoFile != "vlogs/first.mp4" {
+				t.Errorf("Expected only the complete first result, got %+v", results.Results)
+			}
+			if _, err := os.Stat(path + ".corrupt"); err != nil {
+				t.Errorf("Damaged file should be kept aside: %v", err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			// The recovered results are on disk without any further Put
+			store, err = utils.NewResultsStore(path, "")
+			if err != nil {
+				t.Fatalf("Failed to reopen recovered store: %v", err)
+			}
+			defer func() { _ = store.Close() }()
+			if _, ok, _ := store.Get("vlogs/first.mp4"); !ok {
+				t.Error("Expected the recovered result to be saved")
+			}
+		})
+	}
+}
+
+func TestFileStoreRestoresFromBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+
+	store, err := utils.NewResultsStore(path, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, result := range storeTestResults {
+		if err := store.Put(result); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// Nothing in the live file is usable, but the backup still is
+	if err := os.WriteFile(path, []byte("<TranscriptionResults><Transcr"), 0600); err != nil {
+		t.Fatalf("Failed to damage results: %v", err)
+	}
+
+	store, err = utils.NewResultsStore(path, "")
+	if err != nil {
+		t.Fatalf("Failed to reopen damaged store: %v", err)
+	}
+	if _, ok, _ := store.Get("vlogs/first.mp4"); !ok {
+		t.Error("Expected the result from the backup to be restored")
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+var testRetryPolicy = utils.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    10 * time.Millisecond,
+}
+
+func TestRetryPolicyRetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make([]byte, 64)
+		n, _ := r.Body.Read(body)
+		if string(body[:n]) != "payload" {
+			t.Errorf("Expected body to be replayed, got '%s'", body[:n])
+		}
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	resp, err := testRetryPolicy.Client().Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRetryPolicyHonoursRetryAfter(t *testing.T) {
+	for name, retryAfter := range map[string]func() string{
+		"seconds": func() string { return "1" },
+		// HTTP dates have second precision, so ask for two to wait at least one
+		"date": func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			var first, second atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					first.Store(time.Now().UnixNano())
+					w.Header().Set("Retry-After", retryAfter())
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				second.Store(time.Now().UnixNano())
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+
+			resp, err := testRetryPolicy.Client().Get(server.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+				t.Fatalf("Expected success on the second attempt, got status %d after %d attempts", resp.StatusCode, calls.Load())
+			}
+			// The computed backoff is at most 10ms, so only the header explains a longer wait
+			if wait := time.Duration(second.Load() - first.Load()); wait < 900*time.Millisecond {
+				t.Errorf("Expected the retry to wait about a second, waited %s", wait)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyStopsAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp, err := testRetryPolicy.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+	if calls.Load() != int32(testRetryPolicy.MaxAttempts) {
+		t.Errorf("Expected %d attempts, got %d", testRetryPolicy.MaxAttempts, calls.Load())
+	}
+}
+
+func TestRetryPolicyDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	provider, err := utils.NewLocalChatProvider(server.URL, "llama3", testRetryPolicy.Client())
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if _, err := provider.CreateChatCompletion(context.Background(), utils.ChatRequest{}); err == nil {
+		t.Error("Expected an error for a 400 response, got nil")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 attempt, got %d", calls.Load())
+	}
+}
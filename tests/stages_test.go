@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func newStageTestStore(t *testing.T) utils.ResultsStore {
+	t.Helper()
+	store, err := utils.NewResultsStore(filepath.Join(t.TempDir(), "results.xml"), "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	err = store.Put(
+		utils.TranscriptionResult{VideoFile: "done.mp4", Transcription: "Done", Descriptions: []utils.Description{{Number: 1, Content: "Old"}}, BestDescriptionIndex: 1},
+		utils.TranscriptionResult{VideoFile: "transcribed.mp4", Transcription: "Only transcribed"},
+		utils.TranscriptionResult{VideoFile: "silent.mp4", AudioFile: "No audio"},
+		utils.TranscriptionResult{VideoFile: "broken.mp4", Error: &utils.ProcessingError{Stage: utils.StageTranscribe, Message: "boom"}},
+	)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	return store
+}
+
+func TestRegenerateAndRerankDescriptions(t *testing.T) {
+	store := newStageTestStore(t)
+	cfg := utils.DefaultConfig()
+	cfg.Descriptions.Count = 2
+
+	generator := &utils.MockDescriptionGenerator{
+		GenerateDescriptionsFunc: func(ctx context.Context, req utils.DescriptionRequest, attempts int) ([]string, error) {
+			return []string{"New A for " + req.Transcription, "New B"}, nil
+		},
+	}
+	updated, err := utils.RegenerateDescriptions(context.Background(), store, cfg, generator, []string{"done.mp4"})
+	if err != nil {
+		t.Fatalf("RegenerateDescriptions failed: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 updated result, got %d", updated)
+	}
+	done, _, _ := store.Get("done.mp4")
+	if len(done.Descriptions) != 2 || done.Descriptions[0].Content != "New A for Done" || done.BestDescriptionIndex != 0 {
+		t.Errorf("Expected two fresh unranked descriptions, got %+v (best %d)", done.Descriptions, done.BestDescriptionIndex)
+	}
+	if other, _, _ := store.Get("transcribed.mp4"); len(other.Descriptions) != 0 {
+		t.Errorf("Only the selected video should be described, got %+v", other.Descriptions)
+	}
+
+	evaluator := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return len(descriptions), nil
+		},
+	}
+	updated, err = utils.RerankDescriptions(context.Background(), store, cfg, evaluator, nil)
+	if err != nil {
+		t.Fatalf("RerankDescriptions failed: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected only the video with descriptions to be ranked, got %d", updated)
+	}
+	if done, _, _ := store.Get("done.mp4"); done.BestDescriptionIndex != 2 {
+		t.Errorf("Expected best description 2, got %d", done.BestDescriptionIndex)
+	}
+
+	// With KeepGoing a failing stage is recorded instead of aborting
+	cfg.Processing.KeepGoing = true
+	failing := &utils.MockDescriptionEvaluator{
+		EvaluateDescriptionsFunc: func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+			return 0, errors.New("rate limited")
+		},
+	}
+	if _, err := utils.RerankDescriptions(context.Background(), store, cfg, failing, nil); err != nil {
+		t.Fatalf("RerankDescriptions failed despite KeepGoing: %v", err)
+	}
+	if done, _, _ := store.Get("done.mp4"); done.Error == nil || done.Error.Stage != utils.StageEvaluate {
+		t.Errorf("Expected an evaluate error, got %+v", done.Error)
+	}
+
+	if _, err := utils.RegenerateDescriptions(context.Background(), store, cfg, generator, []string{"missing.mp4"}); err == nil {
+		t.Error("Expected an error for a video without a result")
+	}
+}
+
+func TestExportResults(t *testing.T) {
+	src := newStageTestStore(t)
+	dst, err := utils.NewResultsStore(filepath.Join(t.TempDir(), "results.jsonl"), "")
+	if err != nil {
+		t.Fatalf("Failed to open export store: %v", err)
+	}
+
+	exported, err := utils.ExportResults(src, dst)
+	if err != nil {
+		t.Fatalf("ExportResults failed: %v", err)
+	}
+	if exported != 4 {
+		t.Errorf("Expected 4 exported results, got %d", exported)
+	}
+	if broken, ok, _ := dst.Get("broken.mp4"); !ok || broken.Error == nil {
+		t.Errorf("Expected the failed result to be exported with its error, got %+v", broken)
+	}
+}
+
+func TestExportResultsKeepsOlderFormatVersion(t *testing.T) {
+	src := newStageTestStore(t)
+	if err := src.SetFormatVersion(0); err != nil {
+		t.Fatalf("SetFormatVersion failed: %v", err)
+	}
+	dst, err := utils.NewResultsStore(filepath.Join(t.TempDir(), "results.db"), "")
+	if err != nil {
+		t.Fatalf("Failed to open export store: %v", err)
+	}
+	defer func() { _ = dst.Close() }()
+
+	if _, err := utils.ExportResults(src, dst); err != nil {
+		t.Fatalf("ExportResults failed: %v", err)
+	}
+	if version, err := dst.FormatVersion(); err != nil || version != 0 {
+		t.Errorf("Expected unmigrated results to stay at version 0, got %d (%v)", version, err)
+	}
+}
+
+func TestCollectStatus(t *testing.T) {
+	store := newStageTestStore(t)
+	dir := t.TempDir()
+	for _, file := range []string{"done.mp4", "new.mkv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("mock content"), 0644); err != nil {
+			t.Fatalf("Failed to create mock file %s: %v", file, err)
+		}
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Descriptions.Count = 1
+	status, err := utils.CollectStatus(store, cfg, dir)
+	if err != nil {
+		t.Fatalf("CollectStatus failed: %v", err)
+	}
+	if status.Total != 4 || status.Complete != 1 || status.Transcribed != 1 || status.NoAudio != 1 || status.Failed[utils.StageTranscribe] != 1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if len(status.Pending) != 1 || status.Pending[0] != "new.mkv" {
+		t.Errorf("Expected new.mkv to be pending, got %v", status.Pending)
+	}
+}
+
+func TestProcessDirectoryTranscribeOnly(t *testing.T) {
+	testDir := t.TempDir()
+	outputXML := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(filepath.Join(testDir, "video.mp4"), []byte("mock content"), 0644); err != nil {
+		t.Fatalf("Failed to create mock file: %v", err)
+	}
+
+	if err := os.MkdirAll(".tmp", os.ModePerm); err != nil {
+		t.Fatalf("Failed to create .tmp directory: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(".tmp"); err != nil {
+			t.Logf("Failed to remove .tmp directory: %v", err)
+		}
+	}()
+
+	calls := 0
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audioFile string) (bool, error) {
+			calls++
+			return true, nil
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+
+	cfg := utils.DefaultConfig()
+	for run := 0; run < 2; run++ {
+		store, err := utils.NewResultsStore(outputXML, "")
+		if err != nil {
+			t.Fatalf("Failed to open results store: %v", err)
+		}
+		if _, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, nil, nil); err != nil {
+			t.Fatalf("ProcessDirectory failed: %v", err)
+		}
+		results, err := store.Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if len(results.Results) != 1 || results.Results[0].Transcription != "Mock transcription" || len(results.Results[0].Descriptions) != 0 {
+			t.Errorf("Expected a transcription without descriptions, got %+v", results.Results)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the transcribed video to be skipped on the second run, got %d extractions", calls)
+	}
+}
@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+var subtitleSegments = []utils.Segment{
+	{Start: 0, End: 2.5, Text: "Hallo und herzlich willkommen"},
+	{Start: 301.25, End: 3725.004, Text: "zu diesem Video"},
+}
+
+func TestFormatSRT(t *testing.T) {
+	expected := "1\n00:00:00,000 --> 00:00:02,500\nHallo und herzlich willkommen\n\n" +
+		"2\n00:05:01,250 --> 01:02:05,004\nzu diesem Video\n\n"
+	if got := utils.FormatSRT(subtitleSegments); got != expected {
+		t.Errorf("Unexpected SRT output:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestFormatVTT(t *testing.T) {
+	expected := "WEBVTT\n\n" +
+		"00:00:00.000 --> 00:00:02.500\nHallo und herzlich willkommen\n\n" +
+		"00:05:01.250 --> 01:02:05.004\nzu diesem Video\n\n"
+	if got := utils.FormatVTT(subtitleSegments); got != expected {
+		t.Errorf("Unexpected VTT output:\n%q\nexpected:\n%q", got, expected)
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+// writeWAV writes a minimal WAV file with an optional metadata chunk before
+// the samples, like the LIST chunk ffmpeg adds.
+func writeWAV(t *testing.T, path string, metadata string, samples []byte) {
+	t.Helper()
+	le := binary.LittleEndian
+	var data []byte
+	data = append(data, "RIFF"...)
+	data = le.AppendUint32(data, 0)
+	data = append(data, "WAVE"...)
+	data = append(data, "fmt "...)
+	data = le.AppendUint32(data, 16)
+	data = le.AppendUint16(data, 1)     // PCM
+	data = le.AppendUint16(data, 1)     // mono
+	data = le.AppendUint32(data, 16000) // sample rate
+	data = le.AppendUint32(data, 32000) // byte rate
+	data = le.AppendUint16(data, 2)     // block align
+	data = le.AppendUint16(data, 16)    // bits per sample
+	if metadata != "" {
+		data = append(data, "LIST"...)
+		data = le.AppendUint32(data, uint32(len(metadata)))
+		data = append(data, metadata...)
+		if len(metadata)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	data = append(data, "data"...)
+	data = le.AppendUint32(data, uint32(len(samples)))
+	data = append(data, samples...)
+	le.PutUint32(data[4:8], uint32(len(data)-8))
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write WAV file: %v", err)
+	}
+}
+
+func TestCachingTranscriber(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.wav")
+	duplicate := filepath.Join(dir, "duplicate.wav")
+	other := filepath.Join(dir, "other.wav")
+	writeWAV(t, first, "", []byte{1, 2, 3, 4})
+	writeWAV(t, duplicate, "encoder=Lavf", []byte{1, 2, 3, 4})
+	writeWAV(t, other, "", []byte{5, 6, 7, 8})
+
+	calls := 0
+	backend := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			calls++
+			return utils.Transcript{
+				Text:     "Transcript of " + filepath.Base(audioFile),
+				Segments: []utils.Segment{{Start: 0, End: 1, Text: "Transcript"}},
+			}, nil
+		},
+	}
+	cache := &utils.CachingTranscriber{Transcriber: backend, Dir: filepath.Join(dir, "cache"), Params: "model=whisper-1"}
+	ctx := context.Background()
+
+	transcript, err := cache.TranscribeAudio(ctx, first, 5*time.Minute, "")
+	if err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+
+	// Same samples under another name and with other metadata hit the cache
+	cached, err := cache.TranscribeAudio(ctx, duplicate, 5*time.Minute, "")
+	if err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the duplicate to be served from the cache, got %d backend calls", calls)
+	}
+	if cached.Text != transcript.Text || len(cached.Segments) != 1 {
+		t.Errorf("Cached transcript differs: %+v", cached)
+	}
+
+	// Different audio, chunking, parameters or prompt miss the cache
+	if _, err := cache.TranscribeAudio(ctx, other, 5*time.Minute, ""); err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	if _, err := cache.TranscribeAudio(ctx, first, time.Minute, ""); err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	cache.Params = "model=large-v3"
+	if _, err := cache.TranscribeAudio(ctx, first, 5*time.Minute, ""); err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	if _, err := cache.TranscribeAudio(ctx, first, 5*time.Minute, "HugeFrog24"); err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("Expected 5 backend calls, got %d", calls)
+	}
+}
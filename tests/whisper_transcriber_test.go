@@ -0,0 +1,310 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestWhisperServerTranscriber(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not available")
+	}
+
+	audioFile := filepath.Join(t.TempDir(), "silence.wav")
+	cmd := exec.Command("ffmpeg", "-f", "lavfi", "-i", "anullsrc=r=16000:cl=mono", "-t", "1", "-acodec", "pcm_s16le", audioFile)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to create test audio: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Failed to parse upload: %v", err)
+		}
+		if model := r.FormValue("model"); model != "base" {
+			t.Errorf("Expected model 'base', got '%s'", model)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"text":"Stub transcription","segments":[{"start":0,"end":1,"text":" Stub transcription"}]}`))
+	}))
+	defer server.Close()
+
+	transcriber := utils.NewWhisperServerTranscriber(server.URL, "base", nil)
+	transcript, err := transcriber.TranscribeAudio(context.Background(), audioFile, 5*time.Minute, "")
+	if err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	if transcript.Text != "Stub transcription" {
+		t.Errorf("Expected 'Stub transcription', got '%s'", transcript.Text)
+	}
+	if len(transcript.Segments) != 1 || transcript.Segments[0].Text != "Stub transcription" {
+		t.Errorf("Expected one trimmed segment, got %+v", transcript.Segments)
+	}
+}
+
+func TestWhisperServerTranscriberSequential(t *testing.T) {
+	// Three one-second chunks
+	stubMediaTools(t, "2.5")
+	audioFile := filepath.Join(t.TempDir(), "audio.wav")
+
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Failed to parse upload: %v", err)
+		}
+		prompts = append(prompts, r.FormValue("prompt"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"text":" Chunk %d.","segments":[{"start":0,"end":1,"text":" Chunk %d."}]}`, len(prompts), len(prompts))
+	}))
+	defer server.Close()
+
+	transcriber := utils.NewWhisperServerTranscriber(server.URL, "base", nil)
+	transcriber.Concurrency = 3
+	transcriber.Sequential = true
+	transcript, err := transcriber.TranscribeAudio(context.Background(), audioFile, time.Second, "HugeFrog24")
+	if err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+
+	// Each chunk continues the transcript of the one before it
+	expected := []string{"HugeFrog24", "HugeFrog24\nChunk 1.", "HugeFrog24\nChunk 2."}
+	if !reflect.DeepEqual(prompts, expected) {
+		t.Errorf("Expected prompts %q, got %q", expected, prompts)
+	}
+	if transcript.Text != "Chunk 1. Chunk 2. Chunk 3." {
+		t.Errorf("Expected the chunks stitched with single spaces, got '%s'", transcript.Text)
+	}
+	if len(transcript.Segments) != 3 || transcript.Segments[2].Start != 2 {
+		t.Errorf("Expected three segments offset by their chunk, got %+v", transcript.Segments)
+	}
+}
+
+func TestWhisperServerTranscriberSequentialPromptBudget(t *testing.T) {
+	// Two one-second chunks
+	stubMediaTools(t, "1.5")
+	audioFile := filepath.Join(t.TempDir(), "audio.wav")
+
+	chunkText := strings.TrimSpace(strings.Repeat("and then the frog jumped ", 40))
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Failed to parse upload: %v", err)
+		}
+		prompts = append(prompts, r.FormValue("prompt"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"text":%q}`, chunkText)
+	}))
+	defer server.Close()
+
+	terms := make([]string, 60)
+	for i := range terms {
+		terms[i] = fmt.Sprintf("Term%02d", i)
+	}
+	glossary := utils.Glossary{Terms: terms}.Prompt()
+
+	transcriber := utils.NewWhisperServerTranscriber(server.URL, "base", nil)
+	transcriber.Sequential = true
+	if _, err := transcriber.TranscribeAudio(context.Background(), audioFile, time.Second, glossary); err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+	if len(prompts) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(prompts))
+	}
+
+	// The glossary is kept whole and the tail only fills the rest, so
+	// Whisper does not drop the terms at the front
+	prompt := prompts[1]
+	tail := strings.TrimPrefix(prompt, glossary+"\n")
+	if tail == prompt || tail == "" {
+		t.Fatalf("Expected the glossary followed by the previous transcript, got %q", prompt)
+	}
+	if len(prompt) > 800 {
+		t.Errorf("Expected the prompt to stay within 800 characters, got %d", len(prompt))
+	}
+	if !strings.HasSuffix(chunkText, " "+tail) {
+		t.Errorf("Expected the tail to be the end of the previous chunk starting at a word, got %q", tail)
+	}
+}
+
+// stubMediaTools puts ffprobe and ffmpeg scripts first on PATH that report
+// the given duration in seconds and create empty chunk files, so the
+// chunking code runs without the real tools.
+func stubMediaTools(t *testing.T, duration string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub tools are shell scripts")
+	}
+	dir := t.TempDir()
+	writeScript(t, filepath.Join(dir, "ffprobe"), "echo "+duration+"\n")
+	// The chunk file is the last argument
+	writeScript(t, filepath.Join(dir, "ffmpeg"), "for last; do :; done\n: > \"$last\"\n")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	// #nosec G306 -- the script has to be executable
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestWhisperCppTranscriber(t *testing.T) {
+	// Two chunks of five minutes
+	stubMediaTools(t, "420.0")
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	binary := filepath.Join(dir, "whisper-cli")
+	writeScript(t, binary, `echo "$@" >> `+argsFile+`
+echo "whisper_init_from_file_with_params: loading model"
+echo
+echo "[00:00:00.000 --> 00:00:01.500]   Hello there."
+echo "[00:00:01.500 --> 00:01:03.250]  General Kenobi."
+echo "[00:01:03.250 --> 00:01:04.000]   "
+echo "output_txt: saving output"
+`)
+
+	transcriber, err := utils.NewWhisperCppTranscriber(binary, "ggml-base.bin")
+	if err != nil {
+		t.Fatalf("NewWhisperCppTranscriber failed: %v", err)
+	}
+	transcript, err := transcriber.TranscribeAudio(context.Background(), filepath.Join(dir, "audio.wav"), 5*time.Minute, "HugeFrog24")
+	if err != nil {
+		t.Fatalf("TranscribeAudio failed: %v", err)
+	}
+
+	// Lines without timestamps and empty segments are dropped
+	expected := []utils.Segment{
+		{Start: 0, End: 1.5, Text: "Hello there."},
+		{Start: 1.5, End: 63.25, Text: "General Kenobi."},
+		{Start: 300, End: 301.5, Text: "Hello there."},
+		{Start: 301.5, End: 363.25, Text: "General Kenobi."},
+	}
+	if !reflect.DeepEqual(transcript.Segments, expected) {
+		t.Errorf("Expected segments %+v, got %+v", expected, transcript.Segments)
+	}
+	if transcript.Text != "Hello there. General Kenobi. Hello there. General Kenobi." {
+		t.Errorf("Unexpected text '%s'", transcript.Text)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("Failed to read arguments: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "-m ggml-base.bin -f "+filepath.Join(dir, "audio_chunk_0.wav")+" -l auto -np --prompt HugeFrog24") {
+		t.Errorf("Unexpected whisper.cpp invocations %q", calls)
+	}
+}
+
+func TestWhisperServerTranscriberParallelChunks(t *testing.T) {
+	// Three one-second chunks
+	stubMediaTools(t, "2.5")
+	audioFile := filepath.Join(t.TempDir(), "audio.wav")
+
+	chunkIndex := func(r *http.Request) int {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Failed to parse upload: %v", err)
+			return -1
+		}
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("No file uploaded: %v", err)
+			return -1
+		}
+		var i int
+		if _, err := fmt.Sscanf(header.Filename, "audio_chunk_%d.wav", &i); err != nil {
+			t.Errorf("Unexpected chunk name %s", header.Filename)
+		}
+		return i
+	}
+
+	t.Run("reassembles in chunk order", func(t *testing.T) {
+		// Later chunks finish first
+		delays := []time.Duration{200 * time.Millisecond, 0, 100 * time.Millisecond}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			i := chunkIndex(r)
+			time.Sleep(delays[i])
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"text":"Chunk %d.","segments":[{"start":0.5,"end":1,"text":"Chunk %d."}]}`, i, i)
+		}))
+		defer server.Close()
+
+		transcriber := utils.NewWhisperServerTranscriber(server.URL, "base", nil)
+		transcriber.Concurrency = 3
+		transcript, err := transcriber.TranscribeAudio(context.Background(), audioFile, time.Second, "")
+		if err != nil {
+			t.Fatalf("TranscribeAudio failed: %v", err)
+		}
+		if transcript.Text != "Chunk 0. Chunk 1. Chunk 2." {
+			t.Errorf("Expected the chunks in order, got '%s'", transcript.Text)
+		}
+		expected := []utils.Segment{
+			{Start: 0.5, End: 1, Text: "Chunk 0."},
+			{Start: 1.5, End: 2, Text: "Chunk 1."},
+			{Start: 2.5, End: 3, Text: "Chunk 2."},
+		}
+		if !reflect.DeepEqual(transcript.Segments, expected) {
+			t.Errorf("Expected segments %+v, got %+v", expected, transcript.Segments)
+		}
+	})
+
+	t.Run("cancels the other chunks on failure", func(t *testing.T) {
+		var arrived sync.WaitGroup
+		arrived.Add(3)
+		cancelled := make(chan int, 3)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			i := chunkIndex(r)
+			arrived.Done()
+			if i == 1 {
+				// Fail once every chunk is in flight
+				arrived.Wait()
+				http.Error(w, `{"error":{"message":"bad chunk"}}`, http.StatusBadRequest)
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				cancelled <- i
+			case <-time.After(5 * time.Second):
+				t.Errorf("Chunk %d was not cancelled", i)
+			}
+		}))
+		defer server.Close()
+
+		transcriber := utils.NewWhisperServerTranscriber(server.URL, "base", nil)
+		transcriber.Concurrency = 3
+		_, err := transcriber.TranscribeAudio(context.Background(), audioFile, time.Second, "")
+		if err == nil || !strings.Contains(err.Error(), "chunk 1") {
+			t.Fatalf("Expected the failure of chunk 1, got %v", err)
+		}
+
+		// The handlers see the disconnect shortly after the client gives up
+		got := map[int]bool{}
+		for len(got) < 2 {
+			select {
+			case i := <-cancelled:
+				got[i] = true
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected chunks 0 and 2 to be cancelled, got %v", got)
+			}
+		}
+	})
+}
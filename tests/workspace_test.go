@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HugeFrog24/gpt-video-transcriber/utils"
+)
+
+func TestWorkspacesAreIsolated(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.Processing.WorkDir = filepath.Join(t.TempDir(), "work")
+
+	first, err := utils.NewWorkspace(cfg)
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	second, err := utils.NewWorkspace(cfg)
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	if first == second {
+		t.Fatalf("Expected distinct workspaces, got %s twice", first)
+	}
+	audio := filepath.Join(second, "video.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+
+	if err := utils.RemoveWorkspace(cfg, first); err != nil {
+		t.Fatalf("RemoveWorkspace failed: %v", err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", first, err)
+	}
+	if _, err := os.Stat(audio); err != nil {
+		t.Errorf("Removing one workspace touched another: %v", err)
+	}
+
+	cfg.Processing.KeepTemp = true
+	if err := utils.RemoveWorkspace(cfg, second); err != nil {
+		t.Fatalf("RemoveWorkspace failed: %v", err)
+	}
+	if _, err := os.Stat(audio); err != nil {
+		t.Errorf("Expected KeepTemp to keep %s: %v", audio, err)
+	}
+}
+
+func TestProcessDirectoryCleansUpItsWorkspace(t *testing.T) {
+	testDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(testDir, "video.mp4"), []byte("mock content"), 0644); err != nil {
+		t.Fatalf("Failed to create mock file: %v", err)
+	}
+
+	cfg := utils.DefaultConfig()
+	cfg.Output = filepath.Join(testDir, "results.xml")
+	cfg.Processing.WorkDir = filepath.Join(t.TempDir(), "work")
+
+	var audioFile string
+	extractor := &utils.MockAudioExtractor{
+		ExtractAudioFunc: func(ctx context.Context, videoFile, audio string) (bool, error) {
+			audioFile = audio
+			return true, os.WriteFile(audio, []byte("mock audio"), 0644)
+		},
+	}
+	transcriber := &utils.MockAudioTranscriber{
+		TranscribeAudioFunc: func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (utils.Transcript, error) {
+			return utils.Transcript{Text: "Mock transcription"}, nil
+		},
+	}
+
+	store, err := utils.NewResultsStore(cfg.Output, "")
+	if err != nil {
+		t.Fatalf("Failed to open results store: %v", err)
+	}
+	if _, err := utils.ProcessDirectory(context.Background(), testDir, store, cfg, extractor, transcriber, nil, nil); err != nil {
+		t.Fatalf("ProcessDirectory failed: %v", err)
+	}
+
+	if !strings.HasPrefix(audioFile, filepath.ToSlash(cfg.Processing.WorkDir)+"/") {
+		t.Errorf("Expected the audio inside %s, got %s", cfg.Processing.WorkDir, audioFile)
+	}
+	entries, err := os.ReadDir(cfg.Processing.WorkDir)
+	if err != nil {
+		t.Fatalf("Failed to read work directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the run's workspace to be removed, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// AnthropicChatProvider talks to the Anthropic Messages API. System messages
+// are lifted into the top-level system field as that API requires.
+type AnthropicChatProvider struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewAnthropicChatProvider(apiKey, baseURL, model string, httpClient *http.Client) (*AnthropicChatProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable is not set")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("a chat model (LLM_MODEL) must be set for the Anthropic provider")
+	}
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &AnthropicChatProvider{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		client:  httpClient,
+	}, nil
+}
+
+type anthropicRequest struct {
+	Model     string        `json:"model"`
+	System    string        `json:"system,omitempty"`
+	Messages  []ChatMessage `json:"messages"`
+	MaxTokens int           `json:"max_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func (p *AnthropicChatProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (string, error) {
+	body := anthropicRequest{
+		Model:     p.model,
+		MaxTokens: req.MaxTokens,
+	}
+	var system []string
+	for _, msg := range req.Messages {
+		if msg.Role == ChatRoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	body.System = strings.Join(system, "\n\n")
+	if body.MaxTokens == 0 {
+		body.MaxTokens = 1024
+	}
+
+	header := http.Header{}
+	header.Set("x-api-key", p.apiKey)
+	header.Set("anthropic-version", anthropicVersion)
+
+	var resp anthropicResponse
+	if err := postJSON(ctx, p.client, p.baseURL+"/v1/messages", header, body, &resp); err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text content returned")
+	}
+
+	return text.String(), nil
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// BackupPath returns where writeFileAtomic keeps the previous version of
+// path.
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// writeFileAtomic streams write into a temporary file next to path, syncs
+// it and renames it over path, so a crash leaves either the old or the new
+// content but never a truncated file. The replaced version is kept as
+// BackupPath(path).
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tmpName := tmp.Name()
+	// CreateTemp makes the file private; keep the mode of the file being
+	// replaced instead, or what os.Create would give a new one
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to set mode of temporary file: %v", err)
+	}
+	// Only clean up if we never got as far as the rename
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync temporary file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %v", err)
+	}
+
+	if err := rotateBackup(path); err != nil {
+		return fmt.Errorf("failed to back up '%s': %v", path, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to replace '%s': %v", path, err)
+	}
+	renamed = true
+
+	// Persist the rename itself; directories cannot be synced on every
+	// platform, so this is best effort
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+// rotateBackup replaces the backup of path with its current content. A hard
+// link makes this cheap; filesystems without links get a copy.
+func rotateBackup(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	backup := BackupPath(path)
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+	return copyFile(path, backup)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(filepath.Clean(dst), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -4,14 +4,32 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 )
 
-type RealAudioExtractor struct{}
+// StdinInput as the video file makes RealAudioExtractor read the video from
+// a stream instead of a file.
+const StdinInput = "-"
 
-func (RealAudioExtractor) ExtractAudio(ctx context.Context, videoFile, audioFile string) (bool, error) {
+type RealAudioExtractor struct {
+	// Stdin supplies the video when the video file is StdinInput; nil means
+	// the process's standard input.
+	Stdin io.Reader
+}
+
+func (e RealAudioExtractor) ExtractAudio(ctx context.Context, videoFile, audioFile string) (bool, error) {
 	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", videoFile, "-acodec", "pcm_s16le", "-ar", "16000", "-ac", "1", audioFile)
+	ownProcessGroup(cmd)
+	if videoFile == StdinInput {
+		// ffmpeg reads "-" as pipe:0
+		cmd.Stdin = e.Stdin
+		if cmd.Stdin == nil {
+			cmd.Stdin = os.Stdin
+		}
+	}
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	err := cmd.Run()
@@ -7,25 +7,137 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	lingua "github.com/pemistahl/lingua-go"
 	openai "github.com/sashabaranov/go-openai"
 )
 
-type RealAudioTranscriber struct{}
+// Transcript is the text of a transcription together with its timed
+// segments. Segment times are relative to the start of the audio file.
+type Transcript struct {
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments"`
+}
+
+type RealAudioTranscriber struct {
+	// Model is the Whisper model to request; defaults to whisper-1.
+	Model string
+	// Concurrency is the number of chunks sent to the API at once.
+	Concurrency int
+	// Sequential sends one chunk after another instead, each prompted with
+	// the end of the previous chunk's transcript.
+	Sequential bool
+	// Retry governs how transient API failures are retried.
+	Retry RetryPolicy
+}
 
-func (RealAudioTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration) (string, error) {
+func (t RealAudioTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY environment variable is not set")
+		return Transcript{}, fmt.Errorf("OPENAI_API_KEY environment variable is not set")
+	}
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = t.Retry.Client()
+	client := openai.NewClientWithConfig(config)
+
+	return transcribeChunks(ctx, audioFile, maxDuration, t.Concurrency, t.Sequential, prompt, func(ctx context.Context, chunk, prompt string) (Transcript, error) {
+		req := openai.AudioRequest{
+			Model:    pickModel(t.Model, openai.Whisper1),
+			FilePath: chunk,
+			Prompt:   prompt,
+			Format:   openai.AudioResponseFormatVerboseJSON,
+		}
+		resp, err := client.CreateTranscription(ctx, req)
+		if err != nil {
+			return Transcript{}, err
+		}
+		return transcriptFromResponse(resp), nil
+	})
+}
+
+func transcriptFromResponse(resp openai.AudioResponse) Transcript {
+	transcript := Transcript{Text: resp.Text}
+	for _, seg := range resp.Segments {
+		transcript.Segments = append(transcript.Segments, Segment{
+			Start: seg.Start,
+			End:   seg.End,
+			Text:  strings.TrimSpace(seg.Text),
+		})
+	}
+	return transcript
+}
+
+// NewAudioTranscriber returns the transcription backend named by
+// cfg.Transcription.Backend: "openai" (default), "whisper-server" or
+// "whisper-cpp". Each transcribes up to ChunkWorkers chunks of a file at once;
+// HTTP backends retry per cfg.Retry. With a CacheDir the backend is wrapped
+// in a CachingTranscriber.
+func NewAudioTranscriber(cfg Config) (AudioTranscriber, error) {
+	tc := cfg.Transcription
+	backend := strings.ToLower(strings.TrimSpace(tc.Backend))
+
+	var transcriber AudioTranscriber
+	switch backend {
+	case "", "openai":
+		backend = "openai"
+		transcriber = &RealAudioTranscriber{Model: tc.Model, Concurrency: tc.ChunkWorkers, Sequential: tc.Sequential, Retry: cfg.Retry}
+	case "whisper-server":
+		server := NewWhisperServerTranscriber(tc.ServerURL, tc.Model, cfg.Retry.Client())
+		server.Concurrency = tc.ChunkWorkers
+		server.Sequential = tc.Sequential
+		transcriber = server
+	case "whisper-cpp":
+		cpp, err := NewWhisperCppTranscriber(tc.WhisperCppBin, tc.WhisperCppModel)
+		if err != nil {
+			return nil, err
+		}
+		cpp.Concurrency = tc.ChunkWorkers
+		cpp.Sequential = tc.Sequential
+		transcriber = cpp
+	default:
+		return nil, fmt.Errorf("unknown transcriber '%s'", tc.Backend)
 	}
-	client := openai.NewClient(apiKey)
 
+	if tc.DiarizationURL != "" {
+		transcriber = &DiarizingTranscriber{
+			Transcriber: transcriber,
+			Diarizer:    NewHTTPDiarizer(tc.DiarizationURL, cfg.Retry.Client()),
+		}
+	}
+
+	if tc.CacheDir == "" {
+		return transcriber, nil
+	}
+	return &CachingTranscriber{
+		Transcriber: transcriber,
+		Dir:         tc.CacheDir,
+		Params:      fmt.Sprintf("backend=%s model=%s whisper_cpp_model=%s diarized=%t sequential=%t", backend, tc.Model, filepath.Base(tc.WhisperCppModel), tc.DiarizationURL != "", tc.Sequential),
+	}, nil
+}
+
+// maxPromptLength caps the prompt sent with a chunk; Whisper only considers
+// the last 224 tokens of its prompt, and anything before them is lost.
+const maxPromptLength = 800
+
+// promptTailLength is how much of the previous chunk's transcript prompts
+// the next chunk in sequential mode, if the glossary leaves room for it.
+const promptTailLength = 600
+
+// transcribeChunks splits audioFile into chunks of at most maxDuration and
+// runs transcribeChunk on up to concurrency chunks at a time, each with
+// prompt. In sequential mode the chunks are transcribed in order instead, and
+// each prompt ends with the tail of the previous chunk's transcript so
+// spelling and style carry over. The results are joined in chunk order,
+// shifting every chunk's segments by the chunk's start offset. The first
+// failing chunk cancels the others.
+func transcribeChunks(ctx context.Context, audioFile string, maxDuration time.Duration, concurrency int, sequential bool, prompt string, transcribeChunk func(ctx context.Context, chunk, prompt string) (Transcript, error)) (Transcript, error) {
 	// Split audio into chunks
 	chunks, err := splitAudio(ctx, audioFile, maxDuration) // Pass ctx here
 	if err != nil {
-		return "", fmt.Errorf("failed to split audio: %v", err)
+		return Transcript{}, fmt.Errorf("failed to split audio: %v", err)
 	}
 
 	// Ensure all temporary chunk files are cleaned up
@@ -37,24 +149,92 @@ func (RealAudioTranscriber) TranscribeAudio(ctx context.Context, audioFile strin
 		}(chunk)
 	}
 
-	var fullTranscription strings.Builder
-	for _, chunk := range chunks {
-		// Transcribe the chunk
-		req := openai.AudioRequest{
-			Model:    openai.Whisper1,
-			FilePath: chunk,
+	chunkTranscripts := make([]Transcript, len(chunks))
+	if sequential {
+		previous := ""
+		for i, chunk := range chunks {
+			chunkTranscript, err := transcribeChunk(ctx, chunk, continuationPrompt(prompt, previous))
+			if err != nil {
+				return Transcript{}, fmt.Errorf("transcription error in chunk %d: %v", i, err)
+			}
+			chunkTranscripts[i] = chunkTranscript
+			// A silent chunk keeps the context of the one before it
+			if strings.TrimSpace(chunkTranscript.Text) != "" {
+				previous = chunkTranscript.Text
+			}
 		}
-		resp, err := client.CreateTranscription(ctx, req)
-		if err != nil {
-			return "", fmt.Errorf("transcription error: %v", err)
+		return joinChunkTranscripts(chunkTranscripts, maxDuration), nil
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var firstErr error
+
+dispatch:
+	for i, chunk := range chunks {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+
+		wg.Add(1)
+		go func(i int, chunk string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Transcribe the chunk
+			chunkTranscript, err := transcribeChunk(ctx, chunk, prompt)
+			if err != nil {
+				failOnce.Do(func() {
+					firstErr = fmt.Errorf("transcription error in chunk %d: %v", i, err)
+					cancel()
+				})
+				return
+			}
+			chunkTranscripts[i] = chunkTranscript
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return Transcript{}, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return Transcript{}, fmt.Errorf("transcription cancelled: %v", err)
+	}
+
+	return joinChunkTranscripts(chunkTranscripts, maxDuration), nil
+}
+
+// joinChunkTranscripts stitches the chunk transcripts into one, separating
+// their texts by a single space and skipping silent chunks.
+func joinChunkTranscripts(chunkTranscripts []Transcript, maxDuration time.Duration) Transcript {
+	var texts []string
+	var segments []Segment
+	for i, chunkTranscript := range chunkTranscripts {
+		if text := strings.TrimSpace(chunkTranscript.Text); text != "" {
+			texts = append(texts, text)
 		}
-		fullTranscription.WriteString(resp.Text)
-		fullTranscription.WriteString(" ")
 
-		// Temporary file cleanup is handled by defer
+		// Chunk i starts at i*maxDuration, mirroring splitAudio
+		offset := (time.Duration(i) * maxDuration).Seconds()
+		for _, seg := range chunkTranscript.Segments {
+			seg.Start += offset
+			seg.End += offset
+			segments = append(segments, seg)
+		}
 	}
 
-	transcription := strings.TrimSpace(fullTranscription.String())
+	transcription := strings.Join(texts, " ")
 
 	// Detect the language of the transcription
 	detector := lingua.NewLanguageDetectorBuilder().FromAllLanguages().Build()
@@ -63,7 +243,39 @@ func (RealAudioTranscriber) TranscribeAudio(ctx context.Context, audioFile strin
 	// Optionally, log or handle the detected language
 	fmt.Printf("Detected transcription language: %s\n", language.String())
 
-	return transcription, nil
+	return Transcript{Text: transcription, Segments: segments}
+}
+
+// continuationPrompt appends the end of the previous chunk's transcript,
+// starting at a word, to prompt. Whisper reads the prompt as the text
+// preceding the audio, so the next chunk continues it. The glossary prompt
+// is kept whole and the tail only fills what it leaves of maxPromptLength.
+func continuationPrompt(prompt, previous string) string {
+	budget := promptTailLength
+	if prompt != "" {
+		budget = min(budget, maxPromptLength-len(prompt)-1)
+	}
+	if budget <= 0 {
+		return prompt
+	}
+	tail := strings.TrimSpace(previous)
+	if len(tail) > budget {
+		cut := len(tail) - budget
+		for cut < len(tail) && !utf8.RuneStart(tail[cut]) {
+			cut++
+		}
+		tail = tail[cut:]
+		if i := strings.IndexByte(tail, ' '); i >= 0 {
+			tail = tail[i+1:]
+		}
+	}
+	switch {
+	case tail == "":
+		return prompt
+	case prompt == "":
+		return tail
+	}
+	return prompt + "\n" + tail
 }
 
 func splitAudio(ctx context.Context, audioFile string, maxDuration time.Duration) ([]string, error) {
@@ -88,6 +300,7 @@ func splitAudio(ctx context.Context, audioFile string, maxDuration time.Duration
 
 		// #nosec G204
 		cmd := exec.CommandContext(ctx, "ffmpeg", "-i", audioFileSafe, "-ss", fmt.Sprintf("%f", start.Seconds()), "-t", fmt.Sprintf("%f", maxDuration.Seconds()), "-acodec", "pcm_s16le", "-ar", "16000", "-ac", "1", chunkFileSafe)
+		ownProcessGroup(cmd)
 		err := cmd.Run()
 		if err != nil {
 			return chunks, fmt.Errorf("failed to create audio chunk: %v", err)
@@ -101,6 +314,7 @@ func splitAudio(ctx context.Context, audioFile string, maxDuration time.Duration
 
 func getAudioDuration(audioFile string) (time.Duration, error) {
 	cmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", audioFile)
+	ownProcessGroup(cmd)
 	output, err := cmd.Output()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get audio duration: %v", err)
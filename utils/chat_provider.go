@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	ChatRoleSystem = "system"
+	ChatRoleUser   = "user"
+)
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest is the provider-neutral form of a single chat completion call.
+// Model is the component's default; providers configured with their own model
+// use that instead, since OpenAI model names mean nothing to other vendors.
+type ChatRequest struct {
+	Model     string
+	Messages  []ChatMessage
+	MaxTokens int
+}
+
+// NewChatProvider builds the chat backend selected by cfg.Chat.Provider
+// (openai, ollama, llamacpp or anthropic). cfg.Chat.Model and BaseURL override
+// the provider's model and endpoint. Failed requests are retried per cfg.Retry.
+func NewChatProvider(cfg Config) (ChatProvider, error) {
+	provider := strings.ToLower(strings.TrimSpace(cfg.Chat.Provider))
+	model := cfg.Chat.Model
+	baseURL := cfg.Chat.BaseURL
+	httpClient := cfg.Retry.Client()
+
+	switch provider {
+	case "", "openai":
+		return NewOpenAIChatProvider(os.Getenv("OPENAI_API_KEY"), baseURL, model, httpClient)
+	case "ollama":
+		if baseURL == "" {
+			baseURL = "http://localhost:11434"
+		}
+		return NewLocalChatProvider(baseURL, model, httpClient)
+	case "llamacpp", "llama.cpp", "local":
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		return NewLocalChatProvider(baseURL, model, httpClient)
+	case "anthropic":
+		return NewAnthropicChatProvider(os.Getenv("ANTHROPIC_API_KEY"), baseURL, model, httpClient)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider '%s'", provider)
+	}
+}
+
+func pickModel(override, requested string) string {
+	if override != "" {
+		return override
+	}
+	return requested
+}
+
+// postJSON sends body to url and decodes the JSON response into out.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			fmt.Printf("Failed to close response body: %v\n", err)
+		}
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
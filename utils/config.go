@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every tunable setting of a run. It is built from
+// DefaultConfig, then a YAML file, then environment variables; command-line
+// flags are applied last by main.
+type Config struct {
+	// Output is the results file written after every video.
+	Output string `yaml:"output"`
+	// Format is xml, json, jsonl or sqlite; empty infers it from Output's
+	// extension.
+	Format string `yaml:"format"`
+
+	Chat          ChatConfig          `yaml:"chat"`
+	Transcription TranscriptionConfig `yaml:"transcription"`
+	Summary       SummaryConfig       `yaml:"summary"`
+	Descriptions  DescriptionConfig   `yaml:"descriptions"`
+	Processing    ProcessingConfig    `yaml:"processing"`
+	Retry         RetryPolicy         `yaml:"retry"`
+	Timeouts      TimeoutConfig       `yaml:"timeouts"`
+
+	// Persona names the entry of Personas used for this run.
+	Persona  string             `yaml:"persona"`
+	Personas map[string]Persona `yaml:"personas"`
+	// PersonaDirs maps subdirectories of the processed directory to the
+	// persona used for the videos inside them.
+	PersonaDirs map[string]string `yaml:"persona_dirs"`
+
+	// PromptsDir holds prompt templates overriding the built-in ones.
+	PromptsDir string `yaml:"prompts_dir"`
+
+	// Glossary is a glossary file applying to every video, merged with the
+	// GlossaryFileName files of the processed folders.
+	Glossary string `yaml:"glossary"`
+}
+
+type ChatConfig struct {
+	// Provider is openai, ollama, llamacpp or anthropic.
+	Provider string `yaml:"provider"`
+	// Model, when set, is used for every chat call instead of the
+	// per-component models below. Required for non-OpenAI providers.
+	Model   string `yaml:"model"`
+	BaseURL string `yaml:"base_url"`
+
+	DescriptionModel string `yaml:"description_model"`
+	EvaluationModel  string `yaml:"evaluation_model"`
+	SummaryModel     string `yaml:"summary_model"`
+}
+
+type TranscriptionConfig struct {
+	// Backend is openai, whisper-server or whisper-cpp.
+	Backend string `yaml:"backend"`
+	// Model is the Whisper model requested from the API or server.
+	Model         string        `yaml:"model"`
+	ChunkDuration time.Duration `yaml:"chunk_duration"`
+	ChunkWorkers  int           `yaml:"chunk_workers"`
+	// Sequential transcribes the chunks of a file in order, prompting each
+	// with the end of the previous transcript so the style stays consistent
+	// across chunks. ChunkWorkers is ignored then.
+	Sequential bool `yaml:"sequential"`
+	// CacheDir, when set, keeps every transcript keyed by its audio so
+	// reruns and duplicate videos skip the transcription backend.
+	CacheDir string `yaml:"cache_dir"`
+
+	// DiarizationURL, when set, is the endpoint of a diarization service
+	// used to label segments with their speakers.
+	DiarizationURL string `yaml:"diarization_url"`
+
+	ServerURL       string `yaml:"server_url"`
+	WhisperCppBin   string `yaml:"whisper_cpp_bin"`
+	WhisperCppModel string `yaml:"whisper_cpp_model"`
+}
+
+type SummaryConfig struct {
+	// TargetLength is the transcription length in characters above which
+	// it is summarized before generating descriptions.
+	TargetLength  int `yaml:"target_length"`
+	MaxChunkSize  int `yaml:"max_chunk_size"`
+	MaxIterations int `yaml:"max_iterations"`
+}
+
+type DescriptionConfig struct {
+	// Count is the number of descriptions generated per video.
+	Count     int `yaml:"count"`
+	MaxLength int `yaml:"max_length"`
+}
+
+// ProcessingConfig controls how ProcessDirectory walks a directory.
+type ProcessingConfig struct {
+	// Workers is the number of videos processed in parallel (at least 1).
+	Workers int `yaml:"workers"`
+	// SubtitleFormat is "srt", "vtt" or empty to skip writing subtitle files.
+	SubtitleFormat string `yaml:"subtitles"`
+	// KeepGoing records failures on the video's result and carries on with
+	// the next video instead of aborting the run.
+	KeepGoing bool `yaml:"keep_going"`
+	// RetryFailedOnly restricts the run to videos whose stored result has an
+	// error, leaving new and completed videos alone.
+	RetryFailedOnly bool `yaml:"retry_failed_only"`
+	// WorkDir is where each run creates its private directory for extracted
+	// audio; empty means the system temporary directory.
+	WorkDir string `yaml:"workdir"`
+	// KeepTemp leaves the run's temporary files in place for debugging.
+	KeepTemp bool `yaml:"keep_temp"`
+	// TempDir is the working directory of the current run, created by
+	// NewWorkspace. It is set at run time, never from the config file.
+	TempDir string `yaml:"-"`
+}
+
+// TimeoutConfig limits how long each pipeline stage may take for one video.
+// Zero means no limit.
+type TimeoutConfig struct {
+	Extract    time.Duration `yaml:"extract"`
+	Transcribe time.Duration `yaml:"transcribe"`
+	Generate   time.Duration `yaml:"generate"`
+	Evaluate   time.Duration `yaml:"evaluate"`
+}
+
+// stageContext derives the context for one run of stage from ctx, with the
+// stage's timeout if it has one.
+func (t TimeoutConfig) stageContext(ctx context.Context, stage string) (context.Context, context.CancelFunc) {
+	timeouts := map[string]time.Duration{
+		StageExtract:    t.Extract,
+		StageTranscribe: t.Transcribe,
+		StageGenerate:   t.Generate,
+		StageEvaluate:   t.Evaluate,
+	}
+	if timeout := timeouts[stage]; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Output: "transcription_results.xml",
+		Chat: ChatConfig{
+			Provider:         "openai",
+			DescriptionModel: openai.GPT4,
+			EvaluationModel:  openai.GPT3Dot5Turbo16K,
+			SummaryModel:     openai.GPT3Dot5Turbo,
+		},
+		Transcription: TranscriptionConfig{
+			Backend:       "openai",
+			Model:         openai.Whisper1,
+			ChunkDuration: 5 * time.Minute,
+			ChunkWorkers:  1,
+			WhisperCppBin: "whisper-cli",
+		},
+		Summary: SummaryConfig{
+			TargetLength:  2000,
+			MaxChunkSize:  8000,
+			MaxIterations: 10,
+		},
+		Descriptions: DescriptionConfig{
+			Count:     3,
+			MaxLength: 1000,
+		},
+		Processing: ProcessingConfig{
+			Workers: 1,
+		},
+		Retry: DefaultRetryPolicy(),
+	}
+}
+
+// LoadConfig returns the defaults overlaid with the YAML file at path (if
+// path is not empty) and then with environment variables.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read config file: %v", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("failed to parse config file '%s': %v", path, err)
+		}
+	}
+
+	cfg.applyEnv()
+	return cfg, nil
+}
+
+// applyEnv overrides settings that have traditionally been configured
+// through the environment (or .env). API keys are only read from there.
+func (c *Config) applyEnv() {
+	overrides := map[string]*string{
+		"LLM_PROVIDER":       &c.Chat.Provider,
+		"LLM_MODEL":          &c.Chat.Model,
+		"LLM_BASE_URL":       &c.Chat.BaseURL,
+		"WHISPER_MODEL":      &c.Transcription.Model,
+		"WHISPER_SERVER_URL": &c.Transcription.ServerURL,
+		"WHISPER_CPP_BIN":    &c.Transcription.WhisperCppBin,
+		"WHISPER_CPP_MODEL":  &c.Transcription.WhisperCppModel,
+		"DIARIZATION_URL":    &c.Transcription.DiarizationURL,
+	}
+	for name, field := range overrides {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+}
+
+// Validate reports settings that would make a run fail halfway through.
+func (c Config) Validate() error {
+	if c.Output == "" {
+		return fmt.Errorf("output must not be empty")
+	}
+	switch c.Format {
+	case "", FormatXML, FormatJSON, FormatJSONL, FormatSQLite:
+	default:
+		return fmt.Errorf("invalid format '%s': expected xml, json, jsonl or sqlite", c.Format)
+	}
+	if c.Descriptions.Count < 1 {
+		return fmt.Errorf("descriptions.count must be at least 1")
+	}
+	if c.Descriptions.MaxLength < 1 {
+		return fmt.Errorf("descriptions.max_length must be at least 1")
+	}
+	if c.Transcription.ChunkDuration <= 0 {
+		return fmt.Errorf("transcription.chunk_duration must be positive")
+	}
+	if c.Summary.TargetLength < 1 || c.Summary.MaxChunkSize < 1 {
+		return fmt.Errorf("summary.target_length and summary.max_chunk_size must be at least 1")
+	}
+	if c.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("retry.max_attempts must be at least 1")
+	}
+	if c.Retry.BaseDelay <= 0 || c.Retry.MaxDelay < c.Retry.BaseDelay {
+		return fmt.Errorf("retry.base_delay must be positive and retry.max_delay at least as long")
+	}
+	if c.Timeouts.Extract < 0 || c.Timeouts.Transcribe < 0 || c.Timeouts.Generate < 0 || c.Timeouts.Evaluate < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	switch c.Processing.SubtitleFormat {
+	case "", SubtitleFormatSRT, SubtitleFormatVTT:
+	default:
+		return fmt.Errorf("invalid subtitle format '%s': expected srt or vtt", c.Processing.SubtitleFormat)
+	}
+	for name, persona := range c.Personas {
+		if err := persona.validate(); err != nil {
+			return fmt.Errorf("persona '%s': %v", name, err)
+		}
+	}
+	if _, ok := c.Personas[c.Persona]; c.Persona != "" && !ok {
+		return fmt.Errorf("unknown persona '%s'", c.Persona)
+	}
+	for dir, name := range c.PersonaDirs {
+		if _, ok := c.Personas[name]; !ok {
+			return fmt.Errorf("persona_dirs '%s': unknown persona '%s'", dir, name)
+		}
+	}
+	return nil
+}
@@ -3,76 +3,68 @@ package utils
 import (
 	"context"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 
 	lingua "github.com/pemistahl/lingua-go"
-	openai "github.com/sashabaranov/go-openai"
 )
 
 type RealDescriptionEvaluator struct {
-	client *openai.Client
+	provider ChatProvider
+	prompts  *Prompts
+	cfg      Config
 }
 
-func NewRealDescriptionEvaluator() (*RealDescriptionEvaluator, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY environment variable is not set")
-	}
-
-	client := openai.NewClient(apiKey)
+func NewRealDescriptionEvaluator(provider ChatProvider, prompts *Prompts, cfg Config) *RealDescriptionEvaluator {
 	return &RealDescriptionEvaluator{
-		client: client,
-	}, nil
+		provider: provider,
+		prompts:  prompts,
+		cfg:      cfg,
+	}
 }
 
-func (e *RealDescriptionEvaluator) EvaluateDescriptions(descriptions []string, transcription string, filename string) (int, error) {
-	ctx := context.Background()
-
+func (e *RealDescriptionEvaluator) EvaluateDescriptions(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
 	// Detect the language of the transcription
 	detector := lingua.NewLanguageDetectorBuilder().FromAllLanguages().Build()
 	language, _ := detector.DetectLanguageOf(transcription)
 
-	prompt := fmt.Sprintf(`You are an expert in evaluating video descriptions in %s. Analyze the following descriptions and return the number (1-based index) of the best description based on:
-
-- How well it matches the transcription and filename.
-- Style, language consistency, and clarity.
-- Prioritize descriptions that are in the same language as the transcription.
-- Only return the number, no other text.
-
-Filename: %s
-
-Transcription:
-%s
-
-Descriptions:
-%s
-
-Remember, respond with ONLY the number of the best description, nothing else.`, language.String(), filename, transcription, formatDescriptions(descriptions))
+	data := PromptData{
+		Language:      language.String(),
+		Filename:      filename,
+		Transcription: transcription,
+		Descriptions:  descriptions,
+	}
+	systemPrompt, err := e.prompts.Render(PromptEvaluationSystem, data)
+	if err != nil {
+		return 0, err
+	}
+	prompt, err := e.prompts.Render(PromptEvaluationUser, data)
+	if err != nil {
+		return 0, err
+	}
 
 	for attempts := 0; attempts < 3; attempts++ {
-		req := openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo16K,
-			Messages: []openai.ChatCompletionMessage{
+		req := ChatRequest{
+			Model: e.cfg.Chat.EvaluationModel,
+			Messages: []ChatMessage{
 				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a helpful assistant that evaluates video descriptions.",
+					Role:    ChatRoleSystem,
+					Content: systemPrompt,
 				},
 				{
-					Role:    openai.ChatMessageRoleUser,
+					Role:    ChatRoleUser,
 					Content: prompt,
 				},
 			},
 			MaxTokens: 10,
 		}
 
-		resp, err := e.client.CreateChatCompletion(ctx, req)
+		resp, err := e.provider.CreateChatCompletion(ctx, req)
 		if err != nil {
 			return 0, fmt.Errorf("error evaluating descriptions: %v", err)
 		}
 
-		content := strings.TrimSpace(resp.Choices[0].Message.Content)
+		content := strings.TrimSpace(resp)
 		bestIndex, err := strconv.Atoi(content)
 		if err == nil && bestIndex > 0 && bestIndex <= len(descriptions) {
 			return bestIndex, nil
@@ -84,11 +76,3 @@ Remember, respond with ONLY the number of the best description, nothing else.`,
 
 	return 0, fmt.Errorf("failed to get a valid response after multiple attempts")
 }
-
-func formatDescriptions(descriptions []string) string {
-	var result strings.Builder
-	for i, desc := range descriptions {
-		fmt.Fprintf(&result, "%d. %s\n\n", i+1, desc)
-	}
-	return result.String()
-}
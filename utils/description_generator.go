@@ -3,29 +3,53 @@ package utils
 import (
 	"context"
 	"fmt"
-	"os"
+	"path/filepath"
 
 	lingua "github.com/pemistahl/lingua-go"
-	openai "github.com/sashabaranov/go-openai"
 )
 
-type RealDescriptionGenerator struct{}
+// DescriptionRequest is everything the generator knows about one video.
+type DescriptionRequest struct {
+	Transcription string
+	Filename      string
+	Persona       Persona
+	// Speakers lists the speaker labels of a diarized transcription.
+	Speakers []string
+}
+
+// newDescriptionRequest describes result to the generator. A diarized
+// transcription is given turn by turn so the model can tell the speakers
+// apart.
+func newDescriptionRequest(result TranscriptionResult, persona Persona) DescriptionRequest {
+	req := DescriptionRequest{
+		Transcription: result.Transcription,
+		Filename:      filepath.Base(result.VideoFile),
+		Persona:       persona,
+		Speakers:      speakersOf(result.Segments),
+	}
+	if len(req.Speakers) > 0 {
+		req.Transcription = labelledTranscript(result.Segments)
+	}
+	return req
+}
 
-func (RealDescriptionGenerator) GenerateDescriptions(transcription string, filename string, attempts int) ([]string, error) {
-	return GenerateDescriptions(transcription, filename, attempts)
+type RealDescriptionGenerator struct {
+	provider ChatProvider
+	prompts  *Prompts
+	cfg      Config
 }
 
-// GenerateDescriptions sends the transcription and filename to OpenAI GPT-4 to generate descriptions
-func GenerateDescriptions(transcription string, filename string, attempts int) ([]string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
-	ctx := context.Background()
+func NewRealDescriptionGenerator(provider ChatProvider, prompts *Prompts, cfg Config) *RealDescriptionGenerator {
+	return &RealDescriptionGenerator{provider: provider, prompts: prompts, cfg: cfg}
+}
 
+// GenerateDescriptions sends the transcription and filename to the chat provider to generate descriptions
+func (g *RealDescriptionGenerator) GenerateDescriptions(ctx context.Context, descReq DescriptionRequest, attempts int) ([]string, error) {
 	// Create a TextSummarizer instance
-	summarizer := NewTextSummarizer(client)
+	summarizer := NewTextSummarizer(g.provider, g.prompts, g.cfg)
 
 	// Summarize the transcription if it's too long
-	summarizedTranscription, err := summarizer.SummarizeText(transcription, 2000) // Target 2000 characters
+	summarizedTranscription, err := summarizer.SummarizeText(ctx, descReq.Transcription, g.cfg.Summary.TargetLength)
 	if err != nil {
 		return nil, fmt.Errorf("error summarizing transcription: %v", err)
 	}
@@ -37,35 +61,49 @@ func GenerateDescriptions(transcription string, filename string, attempts int) (
 		fmt.Printf("Warning: Language detection may not be reliable for this text\n")
 	}
 
-	// Adjust the prompt to include the detected language
-	systemPrompt := fmt.Sprintf("You are a helpful assistant that generates clear and concise descriptions for videos in %s. Ensure the description is in the same language as the transcription. Write the description from the perspective of the vlogger (HugeFrog24) and correct any misrecognitions of 'HugeFrog24'. Use the filename to infer additional context about the video's content or theme, as it may contain relevant keywords or information not present in the transcription.", language.String())
+	maxDescriptionLength := g.cfg.Descriptions.MaxLength
 
-	const maxDescriptionLength = 1000
+	// Render the prompts with the detected language
+	data := PromptData{
+		Language:      language.String(),
+		Filename:      descReq.Filename,
+		Transcription: summarizedTranscription,
+		MaxLength:     maxDescriptionLength,
+		Persona:       descReq.Persona,
+		Speakers:      descReq.Speakers,
+	}
+	systemPrompt, err := g.prompts.Render(PromptDescriptionSystem, data)
+	if err != nil {
+		return nil, err
+	}
+	userPrompt, err := g.prompts.Render(PromptDescriptionUser, data)
+	if err != nil {
+		return nil, err
+	}
 
 	descriptions := make([]string, 0, attempts)
 
 	for i := 0; i < attempts; i++ {
-		req := openai.ChatCompletionRequest{
-			Model: openai.GPT4,
-			Messages: []openai.ChatCompletionMessage{
+		req := ChatRequest{
+			Model: g.cfg.Chat.DescriptionModel,
+			Messages: []ChatMessage{
 				{
-					Role:    openai.ChatMessageRoleSystem,
+					Role:    ChatRoleSystem,
 					Content: systemPrompt,
 				},
 				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("Based on the following transcription and filename, generate a clear and concise description for the video (maximum %d characters).\n\nFilename: %s\n\nTranscription:\n%s", maxDescriptionLength, filename, summarizedTranscription),
+					Role:    ChatRoleUser,
+					Content: userPrompt,
 				},
 			},
 			MaxTokens: maxDescriptionLength,
 		}
 
-		resp, err := client.CreateChatCompletion(ctx, req)
+		description, err := g.provider.CreateChatCompletion(ctx, req)
 		if err != nil {
 			return descriptions, fmt.Errorf("error generating description: %v", err)
 		}
 
-		description := resp.Choices[0].Message.Content
 		if len(description) > maxDescriptionLength {
 			description = description[:maxDescriptionLength]
 		}
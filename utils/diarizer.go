@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SpeakerTurn is a stretch of audio attributed to one speaker; Start and End
+// are seconds from the beginning of the audio file.
+type SpeakerTurn struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker"`
+}
+
+// HTTPDiarizer asks a local diarization service, such as a pyannote wrapper,
+// who speaks when. The WAV file is posted to URL as the multipart field
+// "file" and the service answers with
+//
+//	{"segments": [{"start": 0.0, "end": 4.2, "speaker": "SPEAKER_00"}, ...]}
+type HTTPDiarizer struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPDiarizer(url string, httpClient *http.Client) *HTTPDiarizer {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &HTTPDiarizer{url: url, client: httpClient}
+}
+
+func (d *HTTPDiarizer) Diarize(ctx context.Context, audioFile string) ([]SpeakerTurn, error) {
+	info, err := os.Stat(audioFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio: %v", err)
+	}
+
+	// Only the multipart framing is held in memory; the audio is streamed
+	// from the file, which is reopened when the request is retried
+	var framing bytes.Buffer
+	form := multipart.NewWriter(&framing)
+	if _, err := form.CreateFormFile("file", filepath.Base(audioFile)); err != nil {
+		return nil, err
+	}
+	headerLen := framing.Len()
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+	header, trailer := framing.Bytes()[:headerLen], framing.Bytes()[headerLen:]
+	openBody := func() (io.ReadCloser, error) {
+		file, err := os.Open(filepath.Clean(audioFile))
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(header), file, bytes.NewReader(trailer)), file}, nil
+	}
+
+	body, err := openBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, body)
+	if err != nil {
+		_ = body.Close()
+		return nil, fmt.Errorf("invalid diarization URL '%s': %v", d.url, err)
+	}
+	req.GetBody = openBody
+	req.ContentLength = int64(len(header)) + info.Size() + int64(len(trailer))
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("diarization request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("diarization service returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var parsed struct {
+		Segments []SpeakerTurn `json:"segments"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse diarization response: %v", err)
+	}
+	return parsed.Segments, nil
+}
+
+// DiarizingTranscriber labels every segment of Transcriber's transcript with
+// the speaker Diarizer hears at that time.
+type DiarizingTranscriber struct {
+	Transcriber AudioTranscriber
+	Diarizer    Diarizer
+}
+
+func (t *DiarizingTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error) {
+	transcript, err := t.Transcriber.TranscribeAudio(ctx, audioFile, maxDuration, prompt)
+	if err != nil {
+		return Transcript{}, err
+	}
+	turns, err := t.Diarizer.Diarize(ctx, audioFile)
+	if err != nil {
+		return Transcript{}, fmt.Errorf("failed to diarize audio: %v", err)
+	}
+	transcript.Segments = assignSpeakers(transcript.Segments, turns)
+	return transcript, nil
+}
+
+// assignSpeakers gives each segment the speaker of the turn overlapping it
+// most. Speakers are renamed S1, S2, ... in the order they first speak, as
+// services label them arbitrarily.
+func assignSpeakers(segments []Segment, turns []SpeakerTurn) []Segment {
+	labels := make(map[string]string)
+	labelled := make([]Segment, len(segments))
+	for i, seg := range segments {
+		best, bestOverlap := "", 0.0
+		for _, turn := range turns {
+			overlap := min(seg.End, turn.End) - max(seg.Start, turn.Start)
+			if overlap > bestOverlap {
+				best, bestOverlap = turn.Speaker, overlap
+			}
+		}
+
+		seg.Speaker = ""
+		if best != "" {
+			if _, ok := labels[best]; !ok {
+				labels[best] = fmt.Sprintf("S%d", len(labels)+1)
+			}
+			seg.Speaker = labels[best]
+		}
+		labelled[i] = seg
+	}
+	return labelled
+}
+
+// speakersOf lists the speakers of segments in the order they first speak.
+func speakersOf(segments []Segment) []string {
+	var speakers []string
+	seen := make(map[string]bool)
+	for _, seg := range segments {
+		if seg.Speaker != "" && !seen[seg.Speaker] {
+			seen[seg.Speaker] = true
+			speakers = append(speakers, seg.Speaker)
+		}
+	}
+	return speakers
+}
+
+// labelledTranscript writes segments as one line per speaker turn, such as
+// "S1: Hello and welcome.", joining consecutive segments of one speaker.
+func labelledTranscript(segments []Segment) string {
+	var b strings.Builder
+	speaker := ""
+	for i, seg := range segments {
+		text := strings.TrimSpace(seg.Text)
+		switch {
+		case i == 0:
+		case seg.Speaker != speaker:
+			b.WriteString("\n")
+		default:
+			b.WriteString(" ")
+		}
+		if i == 0 || seg.Speaker != speaker {
+			label := seg.Speaker
+			if label == "" {
+				label = "?"
+			}
+			b.WriteString(label + ": ")
+			speaker = seg.Speaker
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
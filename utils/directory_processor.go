@@ -1,86 +1,374 @@
 package utils
 
 import (
-	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io/fs"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Description struct {
-	Number  int    `xml:"number,attr"`
-	Content string `xml:",chardata"`
+	Number  int    `xml:"number,attr" json:"number"`
+	Content string `xml:",chardata" json:"content"`
+}
+
+// Segment is a timed piece of the transcription; Start and End are seconds
+// from the beginning of the video. Speaker is S1, S2, ... when the audio was
+// diarized.
+type Segment struct {
+	Start   float64 `xml:"start,attr" json:"start"`
+	End     float64 `xml:"end,attr" json:"end"`
+	Speaker string  `xml:"speaker,attr,omitempty" json:"speaker,omitempty"`
+	Text    string  `xml:",chardata" json:"text"`
 }
 
 type TranscriptionResult struct {
-	VideoFile            string        `xml:"VideoFile"`
-	AudioFile            string        `xml:"AudioFile"`
-	Transcription        string        `xml:"Transcription"`
-	Descriptions         []Description `xml:"Descriptions>Description"`
-	BestDescriptionIndex int           `xml:"BestDescriptionIndex"`
+	VideoFile            string           `xml:"VideoFile" json:"video_file"`
+	AudioFile            string           `xml:"AudioFile" json:"audio_file"`
+	Transcription        string           `xml:"Transcription" json:"transcription"`
+	Segments             []Segment        `xml:"Segments>Segment,omitempty" json:"segments,omitempty"`
+	Descriptions         []Description    `xml:"Descriptions>Description" json:"descriptions"`
+	BestDescriptionIndex int              `xml:"BestDescriptionIndex" json:"best_description_index"`
+	Error                *ProcessingError `xml:"Error,omitempty" json:"error,omitempty"`
+	// Source is nil for results stored before fingerprints were recorded.
+	Source *Fingerprint `xml:"Source,omitempty" json:"source,omitempty"`
+}
+
+// Pipeline stages a video can fail in, recorded on ProcessingError.
+const (
+	StageExtract    = "extract"
+	StageTranscribe = "transcribe"
+	StageGenerate   = "generate"
+	StageEvaluate   = "evaluate"
+)
+
+// ProcessingError records why a video could not be processed completely.
+type ProcessingError struct {
+	Stage   string `xml:"stage,attr" json:"stage"`
+	Message string `xml:",chardata" json:"message"`
+}
+
+// StageError is returned by processVideoFile and tells which stage failed.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// newProcessingError records err, attributing it to the extract stage
+// unless it is a StageError.
+func newProcessingError(err error) *ProcessingError {
+	stage := StageExtract
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		stage = stageErr.Stage
+	}
+	return &ProcessingError{Stage: stage, Message: err.Error()}
 }
 
 type TranscriptionResults struct {
-	XMLName xml.Name              `xml:"TranscriptionResults"`
-	Results []TranscriptionResult `xml:"TranscriptionResult"`
+	XMLName xml.Name `xml:"TranscriptionResults" json:"-"`
+	// Version is the ResultsFormatVersion the results were written in.
+	Version int                   `xml:"version,attr,omitempty" json:"version,omitempty"`
+	Results []TranscriptionResult `xml:"TranscriptionResult" json:"results"`
 }
 
 var videoExtensions = map[string]bool{
 	".mp4": true, ".mov": true, ".avi": true, ".mkv": true, ".wmv": true,
 }
 
+// NoAudioFile is stored as the AudioFile of videos without an audio stream.
+const NoAudioFile = "No audio"
+
+// DirectoryStats counts what ProcessDirectory did with the videos it found.
+type DirectoryStats struct {
+	// Processed videos ran through the pipeline, including Failed ones.
+	Processed int
+	// Failed videos were stored with an error because KeepGoing was set.
+	Failed int
+	// Skipped videos were already finished or, with RetryFailedOnly, had
+	// not failed.
+	Skipped int
+}
+
+// ProcessDirectory runs every video under rootDir that still needs work
+// through the pipeline and persists each result to store. With a nil
+// generator only audio extraction and transcription run.
 func ProcessDirectory(
 	ctx context.Context,
 	rootDir string,
-	outputXML string,
-	descriptionAttempts int,
+	store ResultsStore,
+	cfg Config,
 	extractor AudioExtractor,
 	transcriber AudioTranscriber,
 	generator DescriptionGenerator,
 	evaluator DescriptionEvaluator,
-) (TranscriptionResults, error) {
-	var results TranscriptionResults
+) (DirectoryStats, error) {
+	cleanup, err := withWorkspace(&cfg)
+	if err != nil {
+		return DirectoryStats{}, err
+	}
+	defer cleanup()
+	opts := cfg.Processing
 
-	// Read existing XML file if it exists
-	if _, err := os.Stat(outputXML); err == nil {
-		file, err := os.Open(filepath.Clean(outputXML))
-		if err != nil {
-			return TranscriptionResults{}, fmt.Errorf("failed to open existing XML file: %v", err)
+	// A result is finished once it has everything the requested stages add
+	done := func(result TranscriptionResult) bool {
+		return result.Error == nil && len(result.Descriptions) >= cfg.Descriptions.Count && result.BestDescriptionIndex != 0
+	}
+	if generator == nil {
+		done = func(result TranscriptionResult) bool {
+			return result.Transcription != "" || result.AudioFile == NoAudioFile
 		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				fmt.Printf("Failed to close XML file: %v\n", err)
+	}
+
+	// Discover the videos that still need work before processing any of them
+	jobs, found, err := discoverJobs(rootDir, store, cfg, done)
+	if err != nil {
+		return DirectoryStats{}, err
+	}
+	stats := DirectoryStats{Skipped: found - len(jobs)}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make(chan videoJob)
+	outcomes := make(chan videoOutcome)
+
+	go func() {
+		defer close(pending)
+		for _, job := range jobs {
+			// A graceful stop lets started videos finish but starts no more
+			if stopRequested(ctx) {
+				return
+			}
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+				return
+			case <-stopping(ctx):
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range pending {
+				// Process the video file (pass existing result if any)
+				result, err := processVideoFile(ctx, job.path, job.relativePath, cfg, extractor, transcriber, generator, evaluator, job.existingResult)
+				source := job.source
+				result.Source = &source
+				outcomes <- videoOutcome{job: job, result: result, err: err}
 			}
 		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
 
-		decoder := xml.NewDecoder(file)
-		if err := decoder.Decode(&results); err != nil {
-			return TranscriptionResults{}, fmt.Errorf("failed to decode existing XML: %v", err)
+	// This loop is the only writer to the store, so progress is persisted
+	// one video at a time no matter how many workers run. It keeps draining
+	// after a failure so videos other workers finished are still saved.
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	for outcome := range outcomes {
+		switch {
+		case outcome.err == nil:
+		case errors.Is(outcome.err, ErrStopped) || ctx.Err() != nil:
+			// Stopped or aborted rather than failed: keep what the finished
+			// stages produced so the next run resumes there
+			fmt.Printf("Saving progress of '%s'\n", outcome.job.relativePath)
+		case !opts.KeepGoing:
+			fail(fmt.Errorf("failed to process video file '%s': %v", outcome.job.path, outcome.err))
+			continue
+		default:
+			// Record the failure and keep whatever the earlier stages produced
+			outcome.result.Error = newProcessingError(outcome.err)
+			fmt.Printf("Failed to process '%s' at the %s stage, continuing: %v\n", outcome.job.relativePath, outcome.result.Error.Stage, outcome.err)
 		}
 
-		// Normalize paths in existing results
-		for i := range results.Results {
-			results.Results[i].VideoFile = filepath.ToSlash(filepath.Clean(results.Results[i].VideoFile))
-			results.Results[i].AudioFile = filepath.ToSlash(filepath.Clean(results.Results[i].AudioFile))
+		// Persist the result after each video is processed
+		if err := store.Put(outcome.result); err != nil {
+			fail(fmt.Errorf("failed to save results: %v", err))
+			continue
+		}
+
+		if outcome.err != nil {
+			if outcome.result.Error != nil {
+				stats.Processed++
+				stats.Failed++
+			}
+			continue
+		}
+		stats.Processed++
+		if err := writeSubtitleFile(outcome.job.path, opts.SubtitleFormat, outcome.result); err != nil {
+			fail(err)
 		}
 	}
 
-	// Create a map of processed files using normalized paths
-	processedFiles := make(map[string]*TranscriptionResult)
-	for i, result := range results.Results {
-		processedFiles[result.VideoFile] = &results.Results[i]
+	if firstErr == nil && ctx.Err() != nil {
+		// Cancelled by the caller; finished videos are already persisted
+		firstErr = fmt.Errorf("processing interrupted: %v", ctx.Err())
+	}
+	if firstErr == nil && stopRequested(ctx) {
+		firstErr = ErrStopped
+	}
+	if firstErr != nil {
+		return DirectoryStats{}, firstErr
+	}
+	return stats, nil
+}
+
+// discoverJobs walks rootDir and matches every video against the stored
+// results. A video whose size and modification time are unchanged keeps its
+// result without being read; otherwise its content hash decides whether it
+// was only touched, replaced by a different cut (processed from scratch) or
+// moved from a path that no longer exists (its result follows it).
+// Fingerprint updates are persisted before any video is processed. Besides
+// the jobs it returns how many videos it found.
+func discoverJobs(rootDir string, store ResultsStore, cfg Config, done func(TranscriptionResult) bool) ([]videoJob, int, error) {
+	opts := cfg.Processing
+
+	videos, err := findVideos(rootDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	present := make(map[string]bool, len(videos))
+	for _, video := range videos {
+		present[video.relativePath] = true
 	}
 
-	// Ensure .tmp directory exists
-	if err := os.MkdirAll(".tmp", 0750); err != nil {
-		return TranscriptionResults{}, fmt.Errorf("failed to create .tmp directory: %v", err)
+	// Results whose video is gone may belong to a video that was moved;
+	// count them by hash so only new videos that match one are looked up
+	sources, err := store.Sources()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load fingerprints: %v", err)
+	}
+	orphans := make(map[string]int)
+	for videoFile, source := range sources {
+		if !present[videoFile] && source.Hash != "" {
+			orphans[source.Hash]++
+		}
 	}
 
+	var jobs []videoJob
+	var updates []TranscriptionResult
+	var moved []string
+	for _, job := range videos {
+		job.source, err = statFingerprint(job.path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to stat '%s': %v", job.path, err)
+		}
+
+		existingResult, exists, err := store.Get(job.relativePath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to look up '%s': %v", job.relativePath, err)
+		}
+		if exists && existingResult.Source != nil && existingResult.Source.sameStat(job.source) {
+			job.source = *existingResult.Source
+		} else {
+			if err := job.source.hashFile(job.path); err != nil {
+				return nil, 0, err
+			}
+			source := job.source
+			switch {
+			case !exists:
+				if orphans[source.Hash] == 0 {
+					break
+				}
+				candidates, err := store.FindByHash(source.Hash)
+				if err != nil {
+					return nil, 0, fmt.Errorf("failed to look up results matching '%s': %v", job.relativePath, err)
+				}
+				i := slices.IndexFunc(candidates, func(result TranscriptionResult) bool {
+					return !present[result.VideoFile] && !slices.Contains(moved, result.VideoFile)
+				})
+				if i < 0 {
+					break
+				}
+				orphans[source.Hash]--
+				orphan := candidates[i]
+				fmt.Printf("File '%s' was moved from '%s', keeping its result\n", job.relativePath, orphan.VideoFile)
+				moved = append(moved, orphan.VideoFile)
+				existingResult, exists = orphan, true
+				existingResult.VideoFile = job.relativePath
+				existingResult.Source = &source
+				updates = append(updates, existingResult)
+			case existingResult.Source == nil || existingResult.Source.Hash == source.Hash:
+				// Either stored before fingerprints existed or only touched
+				existingResult.Source = &source
+				updates = append(updates, existingResult)
+			default:
+				fmt.Printf("File '%s' has changed since it was processed, starting over\n", job.relativePath)
+				exists = false
+			}
+		}
+
+		// Check if the file has been processed using normalized path
+		if exists {
+			if done(existingResult) {
+				fmt.Printf("File '%s' already processed. Skipping...\n", job.relativePath)
+				if err := writeSubtitleFile(job.path, opts.SubtitleFormat, existingResult); err != nil {
+					return nil, 0, err
+				}
+				continue
+			}
+			existingResult.Descriptions = slices.Clone(existingResult.Descriptions)
+			job.existingResult = &existingResult
+		}
+		if opts.RetryFailedOnly && (!exists || existingResult.Error == nil) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	if len(updates) > 0 {
+		if err := store.Put(updates...); err != nil {
+			return nil, 0, fmt.Errorf("failed to save fingerprints: %v", err)
+		}
+	}
+	for _, videoFile := range moved {
+		if err := store.Delete(videoFile); err != nil {
+			return nil, 0, err
+		}
+	}
+	return jobs, len(videos), nil
+}
+
+// findVideos lists the video files under rootDir with their normalized
+// relative paths.
+func findVideos(rootDir string) ([]videoJob, error) {
+	var videos []videoJob
 	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -94,49 +382,32 @@ func ProcessDirectory(
 					return fmt.Errorf("failed to compute relative path for '%s': %v", path, err)
 				}
 				normalizedPath := filepath.ToSlash(filepath.Clean(relPath))
-
-				// Check if the file has been processed using normalized path
-				existingResult, exists := processedFiles[normalizedPath]
-				if exists && len(existingResult.Descriptions) >= descriptionAttempts {
-					fmt.Printf("File '%s' already processed with sufficient descriptions. Skipping...\n", normalizedPath)
-					return nil
-				}
-
-				// Process the video file (pass existing result if any)
-				result, err := processVideoFile(ctx, path, normalizedPath, descriptionAttempts, extractor, transcriber, generator, evaluator, existingResult)
-				if err != nil {
-					return fmt.Errorf("failed to process video file '%s': %v", path, err)
-				}
-
-				if exists {
-					// Update the existing result
-					*existingResult = result
-				} else {
-					// Add new result
-					results.Results = append(results.Results, result)
-				}
-
-				// Write the updated results to the XML file after each video is processed
-				if err := writeXMLFile(outputXML, results); err != nil {
-					return fmt.Errorf("failed to write XML file: %v", err)
-				}
+				videos = append(videos, videoJob{path: path, relativePath: normalizedPath})
 			}
 		}
 		return nil
 	})
+	return videos, err
+}
 
-	if err != nil {
-		return TranscriptionResults{}, err
-	}
+type videoJob struct {
+	path           string
+	relativePath   string
+	source         Fingerprint
+	existingResult *TranscriptionResult
+}
 
-	return results, nil
+type videoOutcome struct {
+	job    videoJob
+	result TranscriptionResult
+	err    error
 }
 
 func processVideoFile(
 	ctx context.Context,
 	videoFile string,
 	relativePath string,
-	descriptionAttempts int,
+	cfg Config,
 	extractor AudioExtractor,
 	transcriber AudioTranscriber,
 	generator DescriptionGenerator,
@@ -148,65 +419,105 @@ func processVideoFile(
 	// Use existing result if available
 	if existingResult != nil {
 		result = *existingResult
+		result.Error = nil
 	} else {
 		result.VideoFile = relativePath
 	}
 
 	// If there is no transcription, we need to extract audio and transcribe
 	if result.Transcription == "" {
+		glossary, err := glossaryFor(cfg, videoFile, relativePath)
+		if err != nil {
+			return result, &StageError{Stage: StageTranscribe, Err: err}
+		}
+
 		// Generate a unique audio file name and normalize it
-		audioFile := filepath.ToSlash(filepath.Clean(filepath.Join(".tmp", fmt.Sprintf("%s_%d.wav", strings.TrimSuffix(filepath.Base(relativePath), filepath.Ext(relativePath)), time.Now().UnixNano()))))
+		audioFile := filepath.ToSlash(filepath.Clean(filepath.Join(cfg.Processing.TempDir, fmt.Sprintf("%s_%d.wav", strings.TrimSuffix(filepath.Base(relativePath), filepath.Ext(relativePath)), time.Now().UnixNano()))))
 
 		// Use the injected extractor
-		hasAudio, err := extractor.ExtractAudio(ctx, videoFile, audioFile)
+		stageCtx, cancel := cfg.Timeouts.stageContext(ctx, StageExtract)
+		hasAudio, err := extractor.ExtractAudio(stageCtx, videoFile, audioFile)
+		cancel()
 		if err != nil {
-			return TranscriptionResult{}, fmt.Errorf("failed to extract audio: %v", err)
+			return result, &StageError{Stage: StageExtract, Err: fmt.Errorf("failed to extract audio: %v", err)}
 		}
 		if !hasAudio {
 			fmt.Printf("Skipping file '%s' as it has no audio stream\n", relativePath)
 			return TranscriptionResult{
 				VideoFile: relativePath,
-				AudioFile: "No audio",
+				AudioFile: NoAudioFile,
 			}, nil
 		}
 
 		result.AudioFile = audioFile
 
 		// Use the injected transcriber
-		transcription, err := transcriber.TranscribeAudio(ctx, audioFile, 5*time.Minute)
+		stageCtx, cancel = cfg.Timeouts.stageContext(ctx, StageTranscribe)
+		transcript, err := transcriber.TranscribeAudio(stageCtx, audioFile, cfg.Transcription.ChunkDuration, glossary.Prompt())
+		cancel()
 		if err != nil {
-			return TranscriptionResult{}, fmt.Errorf("failed to transcribe audio: %v", err)
+			return result, &StageError{Stage: StageTranscribe, Err: fmt.Errorf("failed to transcribe audio: %v", err)}
+		}
+		result.Transcription = glossary.Correct(transcript.Text)
+		result.Segments = make([]Segment, len(transcript.Segments))
+		for i, seg := range transcript.Segments {
+			seg.Text = glossary.Correct(seg.Text)
+			result.Segments[i] = seg
 		}
-		result.Transcription = transcription
+	}
+
+	if generator == nil {
+		return result, nil
+	}
+	// Audio is not kept between runs, so a stop only takes effect once the
+	// transcription is done
+	if stopRequested(ctx) {
+		return result, ErrStopped
 	}
 
 	// Calculate how many descriptions need to be generated
 	existingDescriptionsCount := len(result.Descriptions)
-	descriptionsToGenerate := descriptionAttempts - existingDescriptionsCount
+	descriptionsToGenerate := cfg.Descriptions.Count - existingDescriptionsCount
 
-	if descriptionsToGenerate > 0 {
-		// Use the injected generator to generate missing descriptions
-		newDescriptions, err := generator.GenerateDescriptions(result.Transcription, filepath.Base(relativePath), descriptionsToGenerate)
-		if err != nil {
-			return TranscriptionResult{}, fmt.Errorf("failed to generate descriptions: %v", err)
-		}
+	// A previous run may have generated descriptions but failed to rank them
+	needsEvaluation := len(result.Descriptions) > 0 && result.BestDescriptionIndex == 0
 
-		// Escape and append new descriptions
-		for i, desc := range newDescriptions {
-			escapedDesc := &bytes.Buffer{}
-			if err := xml.EscapeText(escapedDesc, []byte(desc)); err != nil {
-				return TranscriptionResult{}, fmt.Errorf("failed to escape description: %v", err)
+	if descriptionsToGenerate > 0 || needsEvaluation {
+		if descriptionsToGenerate > 0 {
+			persona, err := cfg.PersonaFor(relativePath)
+			if err != nil {
+				return result, &StageError{Stage: StageGenerate, Err: err}
+			}
+
+			// Use the injected generator to generate missing descriptions
+			stageCtx, cancel := cfg.Timeouts.stageContext(ctx, StageGenerate)
+			newDescriptions, err := generator.GenerateDescriptions(stageCtx, newDescriptionRequest(result, persona), descriptionsToGenerate)
+			cancel()
+			if err != nil {
+				return result, &StageError{Stage: StageGenerate, Err: fmt.Errorf("failed to generate descriptions: %v", err)}
+			}
+
+			// Store descriptions as generated; the results encoder escapes them
+			for i, desc := range newDescriptions {
+				result.Descriptions = append(result.Descriptions, Description{
+					Number:  existingDescriptionsCount + i + 1,
+					Content: desc,
+				})
+			}
+			// The new set is unranked until evaluation finishes
+			result.BestDescriptionIndex = 0
+
+			if stopRequested(ctx) {
+				return result, ErrStopped
 			}
-			result.Descriptions = append(result.Descriptions, Description{
-				Number:  existingDescriptionsCount + i + 1,
-				Content: escapedDesc.String(),
-			})
 		}
 
 		// Re-evaluate descriptions
-		bestIndex, err := evaluator.EvaluateDescriptions(getDescriptionContents(result.Descriptions), result.Transcription, filepath.Base(relativePath))
+		stageCtx, cancel := cfg.Timeouts.stageContext(ctx, StageEvaluate)
+		bestIndex, err := evaluator.EvaluateDescriptions(stageCtx, getDescriptionContents(result.Descriptions), result.Transcription, filepath.Base(relativePath))
+		cancel()
 		if err != nil {
-			return TranscriptionResult{}, fmt.Errorf("failed to evaluate descriptions: %v", err)
+			return result, &StageError{Stage: StageEvaluate, Err: fmt.Errorf("failed to evaluate descriptions: %v", err)}
 		}
 		result.BestDescriptionIndex = bestIndex
 		fmt.Printf("Suggested best description: %d\n", bestIndex)
@@ -217,29 +528,22 @@ func processVideoFile(
 	return result, nil
 }
 
-func writeXMLFile(outputXML string, results TranscriptionResults) error {
-	file, err := os.Create(filepath.Clean(outputXML))
-	if err != nil {
-		return fmt.Errorf("failed to create XML file '%s': %v", outputXML, err)
+// writeSubtitleFile writes the result's segments next to the video file when
+// a subtitle format was requested.
+func writeSubtitleFile(videoFile string, format string, result TranscriptionResult) error {
+	if format == "" || result.Transcription == "" {
+		return nil
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Printf("Failed to close XML file: %v\n", err)
-		}
-	}()
-
-	encoder := xml.NewEncoder(file)
-	encoder.Indent("", "  ")
-	if err := encoder.Encode(results); err != nil {
-		return fmt.Errorf("failed to encode XML to '%s': %v", outputXML, err)
+	if len(result.Segments) == 0 {
+		fmt.Printf("No timed segments stored for '%s', skipping subtitles\n", result.VideoFile)
+		return nil
 	}
 
-	// Make sure to flush the encoder
-	if err := encoder.Flush(); err != nil {
-		return fmt.Errorf("failed to flush XML encoder: %v", err)
+	subtitleFile, err := WriteSubtitles(videoFile, format, result.Segments)
+	if err != nil {
+		return fmt.Errorf("failed to write subtitles for '%s': %v", videoFile, err)
 	}
-
-	fmt.Printf("XML results written to %s\n", outputXML)
+	fmt.Printf("Subtitles written to %s\n", subtitleFile)
 	return nil
 }
 
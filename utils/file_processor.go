@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ProcessFile runs a single video through the same pipeline as
+// ProcessDirectory, including evaluation, and keys the result by the file
+// name. When store is not nil a stored result for the same content is
+// resumed and the new result is saved, failed or not. With a nil generator
+// only audio extraction and transcription run.
+func ProcessFile(
+	ctx context.Context,
+	videoFile string,
+	store ResultsStore,
+	cfg Config,
+	extractor AudioExtractor,
+	transcriber AudioTranscriber,
+	generator DescriptionGenerator,
+	evaluator DescriptionEvaluator,
+) (TranscriptionResult, error) {
+	name := filepath.Base(videoFile)
+
+	cleanup, err := withWorkspace(&cfg)
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	defer cleanup()
+
+	source, err := statFingerprint(videoFile)
+	if err != nil {
+		return TranscriptionResult{}, fmt.Errorf("failed to stat '%s': %v", videoFile, err)
+	}
+	if err := source.hashFile(videoFile); err != nil {
+		return TranscriptionResult{}, err
+	}
+
+	var existingResult *TranscriptionResult
+	if store != nil {
+		stored, exists, err := store.Get(name)
+		if err != nil {
+			return TranscriptionResult{}, fmt.Errorf("failed to look up '%s': %v", name, err)
+		}
+		// A different video stored under the same name is replaced
+		if exists && (stored.Source == nil || stored.Source.Hash == source.Hash) {
+			stored.Descriptions = slices.Clone(stored.Descriptions)
+			existingResult = &stored
+		}
+	}
+
+	result, processErr := processVideoFile(ctx, videoFile, name, cfg, extractor, transcriber, generator, evaluator, existingResult)
+	result.Source = &source
+	// A stopped or aborted run is resumed rather than recorded as a failure
+	if processErr != nil && !errors.Is(processErr, ErrStopped) && ctx.Err() == nil {
+		result.Error = newProcessingError(processErr)
+	}
+
+	if store != nil {
+		if err := store.Put(result); err != nil {
+			return result, fmt.Errorf("failed to save results: %v", err)
+		}
+	}
+	if processErr != nil {
+		return result, processErr
+	}
+
+	if err := writeSubtitleFile(videoFile, cfg.Processing.SubtitleFormat, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ProcessStream runs the video read from stream through the pipeline. name
+// keys the result and is the file name shown to the chat model. Nothing is
+// stored and no subtitles are written. A failed result is returned with its
+// Error set along with the error.
+//
+// The stream is copied into the workspace first: ffmpeg cannot seek in a
+// pipe, so MP4 files with their index at the end could not be decoded
+// straight from it.
+func ProcessStream(
+	ctx context.Context,
+	name string,
+	stream io.Reader,
+	cfg Config,
+	extractor AudioExtractor,
+	transcriber AudioTranscriber,
+	generator DescriptionGenerator,
+	evaluator DescriptionEvaluator,
+) (TranscriptionResult, error) {
+	cleanup, err := withWorkspace(&cfg)
+	if err != nil {
+		return TranscriptionResult{}, err
+	}
+	defer cleanup()
+
+	videoFile := filepath.Join(cfg.Processing.TempDir, "stream"+filepath.Ext(name))
+	if err := copyStream(stream, videoFile); err != nil {
+		err = &StageError{Stage: StageExtract, Err: fmt.Errorf("failed to read video stream: %v", err)}
+		return TranscriptionResult{VideoFile: name, Error: newProcessingError(err)}, err
+	}
+
+	result, err := processVideoFile(ctx, videoFile, name, cfg, extractor, transcriber, generator, evaluator, nil)
+	if err != nil && !errors.Is(err, ErrStopped) && ctx.Err() == nil {
+		result.Error = newProcessingError(err)
+	}
+	return result, err
+}
+
+func copyStream(stream io.Reader, path string) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, stream); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
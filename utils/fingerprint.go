@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fingerprintSampleSize is how much is hashed from the start, middle and end
+// of a video. Files up to three samples long are hashed completely.
+const fingerprintSampleSize = 1 << 20
+
+// Fingerprint identifies the content of a video file, so a result follows
+// the file when it is moved or renamed and is redone when the file is
+// replaced by a different cut.
+type Fingerprint struct {
+	Size    int64     `xml:"size,attr" json:"size"`
+	ModTime time.Time `xml:"modified,attr" json:"modified"`
+	// Hash is a SHA-256 over the size and samples of the content.
+	Hash string `xml:"sha256,attr" json:"sha256"`
+}
+
+// statFingerprint returns the size and modification time of path without
+// reading it; Hash is left empty.
+func statFingerprint(path string) (Fingerprint, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	return Fingerprint{Size: info.Size(), ModTime: info.ModTime().UTC()}, nil
+}
+
+// sameStat reports whether size and modification time match, in which case
+// the content is assumed unchanged without hashing it.
+func (f Fingerprint) sameStat(other Fingerprint) bool {
+	return f.Size == other.Size && f.ModTime.Equal(other.ModTime)
+}
+
+// hashFile fills in f.Hash from the content of path; f.Size must already
+// be set by statFingerprint.
+func (f *Fingerprint) hashFile(path string) error {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to open '%s' for hashing: %v", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(f.Size))
+	hash.Write(size[:])
+
+	if f.Size <= 3*fingerprintSampleSize {
+		if _, err := io.Copy(hash, file); err != nil {
+			return fmt.Errorf("failed to hash '%s': %v", path, err)
+		}
+	} else {
+		for _, offset := range []int64{0, (f.Size - fingerprintSampleSize) / 2, f.Size - fingerprintSampleSize} {
+			if _, err := io.Copy(hash, io.NewSectionReader(file, offset, fingerprintSampleSize)); err != nil {
+				return fmt.Errorf("failed to hash '%s': %v", path, err)
+			}
+		}
+	}
+
+	f.Hash = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GlossaryFileName is looked up in every folder from the processed
+// directory down to a video's folder.
+const GlossaryFileName = "glossary.yaml"
+
+// Glossary helps transcription with names and words Whisper tends to get
+// wrong. Terms are sent as the prompt of every chunk; Corrections map
+// recurring misrecognitions to their correct spelling and are applied to the
+// transcript before it is stored.
+type Glossary struct {
+	Terms       []string          `yaml:"terms"`
+	Corrections map[string]string `yaml:"corrections"`
+}
+
+// LoadGlossary reads the glossary file at path.
+func LoadGlossary(path string) (Glossary, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return Glossary{}, fmt.Errorf("failed to read glossary: %v", err)
+	}
+	var g Glossary
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&g); err != nil && !errors.Is(err, io.EOF) {
+		return Glossary{}, fmt.Errorf("failed to parse glossary '%s': %v", path, err)
+	}
+	return g, nil
+}
+
+// glossaryFor merges the glossary named in the config with the
+// GlossaryFileName files in the folders from the processed directory down
+// to the video's, so deeper folders add terms and override corrections.
+// relativePath is the video's slash-separated path below that directory.
+func glossaryFor(cfg Config, videoFile, relativePath string) (Glossary, error) {
+	var g Glossary
+	if cfg.Glossary != "" {
+		global, err := LoadGlossary(cfg.Glossary)
+		if err != nil {
+			return Glossary{}, err
+		}
+		g = g.merge(global)
+	}
+	if videoFile == StdinInput {
+		return g, nil
+	}
+
+	// The video's folder first, then up to the processed directory
+	dirs := []string{filepath.Dir(videoFile)}
+	for i := 0; i < strings.Count(relativePath, "/"); i++ {
+		dirs = append(dirs, filepath.Dir(dirs[len(dirs)-1]))
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := filepath.Join(dirs[i], GlossaryFileName)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		folder, err := LoadGlossary(path)
+		if err != nil {
+			return Glossary{}, err
+		}
+		g = g.merge(folder)
+	}
+	return g, nil
+}
+
+// merge returns g with the terms of other added and its corrections taking
+// precedence.
+func (g Glossary) merge(other Glossary) Glossary {
+	merged := Glossary{Terms: append([]string(nil), g.Terms...), Corrections: make(map[string]string)}
+	for _, term := range other.Terms {
+		if !containsFold(merged.Terms, term) {
+			merged.Terms = append(merged.Terms, term)
+		}
+	}
+	for wrong, right := range g.Corrections {
+		merged.Corrections[wrong] = right
+	}
+	for wrong, right := range other.Corrections {
+		merged.Corrections[wrong] = right
+	}
+	return merged
+}
+
+// Prompt lists the terms for the Whisper prompt, leaving out those beyond
+// maxPromptLength characters.
+func (g Glossary) Prompt() string {
+	prompt := ""
+	for _, term := range g.Terms {
+		next := term
+		if prompt != "" {
+			next = prompt + ", " + term
+		}
+		if len(next) > maxPromptLength {
+			break
+		}
+		prompt = next
+	}
+	return prompt
+}
+
+// Correct applies the corrections to text. They match whole words or
+// phrases, case-sensitively, and the longest one that ends at a word boundary
+// wins where several start at the same place, so the outcome never depends
+// on map order.
+func (g Glossary) Correct(text string) string {
+	if len(g.Corrections) == 0 {
+		return text
+	}
+	wrong := make([]string, 0, len(g.Corrections))
+	for w := range g.Corrections {
+		if w != "" {
+			wrong = append(wrong, w)
+		}
+	}
+	sort.Slice(wrong, func(i, j int) bool {
+		if len(wrong[i]) != len(wrong[j]) {
+			return len(wrong[i]) > len(wrong[j])
+		}
+		return wrong[i] < wrong[j]
+	})
+
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(text); {
+		match := ""
+		if wordBoundary(text, i) {
+			for _, w := range wrong {
+				if strings.HasPrefix(text[i:], w) && wordBoundary(text, i+len(w)) {
+					match = w
+					break
+				}
+			}
+		}
+		if match == "" {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			continue
+		}
+		b.WriteString(text[last:i])
+		b.WriteString(g.Corrections[match])
+		i += len(match)
+		last = i
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// wordBoundary reports whether i in text does not fall between two letters
+// or digits.
+func wordBoundary(text string, i int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[i:])
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	return i == 0 || i == len(text) || !isWord(before) || !isWord(after)
+}
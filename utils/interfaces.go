@@ -10,13 +10,22 @@ type AudioExtractor interface {
 }
 
 type AudioTranscriber interface {
-	TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration) (string, error)
+	TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error)
 }
 
 type DescriptionGenerator interface {
-	GenerateDescriptions(transcription string, filename string, attempts int) ([]string, error)
+	GenerateDescriptions(ctx context.Context, req DescriptionRequest, attempts int) ([]string, error)
 }
 
 type DescriptionEvaluator interface {
-	EvaluateDescriptions(descriptions []string, transcription string, filename string) (int, error)
+	EvaluateDescriptions(ctx context.Context, descriptions []string, transcription string, filename string) (int, error)
+}
+
+// Diarizer finds who speaks when in an audio file.
+type Diarizer interface {
+	Diarize(ctx context.Context, audioFile string) ([]SpeakerTurn, error)
+}
+
+type ChatProvider interface {
+	CreateChatCompletion(ctx context.Context, req ChatRequest) (string, error)
 }
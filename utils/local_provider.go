@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// LocalChatProvider talks to a self-hosted model server through the
+// OpenAI-style /v1/chat/completions endpoint that both Ollama and the
+// llama.cpp server expose. No API key is sent.
+type LocalChatProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewLocalChatProvider(baseURL, model string, httpClient *http.Client) (*LocalChatProvider, error) {
+	if model == "" {
+		return nil, fmt.Errorf("a chat model (LLM_MODEL) must be set for local model servers")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &LocalChatProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		client:  httpClient,
+	}, nil
+}
+
+type localChatRequest struct {
+	Model     string        `json:"model"`
+	Messages  []ChatMessage `json:"messages"`
+	MaxTokens int           `json:"max_tokens,omitempty"`
+	Stream    bool          `json:"stream"`
+}
+
+type localChatResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (p *LocalChatProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (string, error) {
+	body := localChatRequest{
+		Model:     p.model,
+		Messages:  req.Messages,
+		MaxTokens: req.MaxTokens,
+	}
+
+	var resp localChatResponse
+	if err := postJSON(ctx, p.client, p.baseURL+"/v1/chat/completions", nil, body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+)
+
+// escapedText undoes exactly what xml.EscapeText produces. Earlier versions
+// escaped descriptions (and, before that, transcriptions) before handing
+// them to the encoder, so stored text still carries one level of entities.
+var escapedText = strings.NewReplacer(
+	"&#34;", `"`,
+	"&#39;", "'",
+	"&amp;", "&",
+	"&lt;", "<",
+	"&gt;", ">",
+	"&#x9;", "\t",
+	"&#xA;", "\n",
+	"&#xD;", "\r",
+)
+
+// MigrateResults repairs results written by earlier versions in place,
+// records ResultsFormatVersion and returns how many were changed. Results
+// already in that version are left alone, so text that merely contains
+// entity names, such as a description about HTML, is never unescaped.
+func MigrateResults(store ResultsStore) (int, error) {
+	version, err := store.FormatVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version >= ResultsFormatVersion {
+		return 0, nil
+	}
+
+	results, err := store.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	var changed []TranscriptionResult
+	for _, result := range results.Results {
+		if repairEscaping(&result) {
+			changed = append(changed, result)
+		}
+	}
+	if len(changed) > 0 {
+		if err := store.Put(changed...); err != nil {
+			return 0, err
+		}
+	}
+	if err := store.SetFormatVersion(ResultsFormatVersion); err != nil {
+		return 0, err
+	}
+	return len(changed), nil
+}
+
+// repairEscaping unescapes the text fields of result and reports whether
+// any of them changed.
+func repairEscaping(result *TranscriptionResult) bool {
+	changed := false
+	unescape := func(s *string) {
+		if repaired := escapedText.Replace(*s); repaired != *s {
+			*s = repaired
+			changed = true
+		}
+	}
+
+	unescape(&result.Transcription)
+	// Copy before editing so the store's own slices stay untouched
+	result.Segments = slices.Clone(result.Segments)
+	for i := range result.Segments {
+		unescape(&result.Segments[i].Text)
+	}
+	result.Descriptions = slices.Clone(result.Descriptions)
+	for i := range result.Descriptions {
+		unescape(&result.Descriptions[i].Content)
+	}
+	return changed
+}
@@ -14,25 +14,41 @@ func (m *MockAudioExtractor) ExtractAudio(ctx context.Context, videoFile, audioF
 }
 
 type MockAudioTranscriber struct {
-	TranscribeAudioFunc func(ctx context.Context, audioFile string, maxDuration time.Duration) (string, error)
+	TranscribeAudioFunc func(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error)
 }
 
-func (m *MockAudioTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration) (string, error) {
-	return m.TranscribeAudioFunc(ctx, audioFile, maxDuration)
+func (m *MockAudioTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error) {
+	return m.TranscribeAudioFunc(ctx, audioFile, maxDuration, prompt)
 }
 
 type MockDescriptionGenerator struct {
-	GenerateDescriptionsFunc func(transcription string, filename string, attempts int) ([]string, error)
+	GenerateDescriptionsFunc func(ctx context.Context, req DescriptionRequest, attempts int) ([]string, error)
 }
 
-func (m *MockDescriptionGenerator) GenerateDescriptions(transcription string, filename string, attempts int) ([]string, error) {
-	return m.GenerateDescriptionsFunc(transcription, filename, attempts)
+func (m *MockDescriptionGenerator) GenerateDescriptions(ctx context.Context, req DescriptionRequest, attempts int) ([]string, error) {
+	return m.GenerateDescriptionsFunc(ctx, req, attempts)
 }
 
 type MockDescriptionEvaluator struct {
-	EvaluateDescriptionsFunc func(descriptions []string, transcription string, filename string) (int, error)
+	EvaluateDescriptionsFunc func(ctx context.Context, descriptions []string, transcription string, filename string) (int, error)
 }
 
-func (m *MockDescriptionEvaluator) EvaluateDescriptions(descriptions []string, transcription string, filename string) (int, error) {
-	return m.EvaluateDescriptionsFunc(descriptions, transcription, filename)
+func (m *MockDescriptionEvaluator) EvaluateDescriptions(ctx context.Context, descriptions []string, transcription string, filename string) (int, error) {
+	return m.EvaluateDescriptionsFunc(ctx, descriptions, transcription, filename)
+}
+
+type MockDiarizer struct {
+	DiarizeFunc func(ctx context.Context, audioFile string) ([]SpeakerTurn, error)
+}
+
+func (m *MockDiarizer) Diarize(ctx context.Context, audioFile string) ([]SpeakerTurn, error) {
+	return m.DiarizeFunc(ctx, audioFile)
+}
+
+type MockChatProvider struct {
+	CreateChatCompletionFunc func(ctx context.Context, req ChatRequest) (string, error)
+}
+
+func (m *MockChatProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (string, error) {
+	return m.CreateChatCompletionFunc(ctx, req)
 }
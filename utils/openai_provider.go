@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type OpenAIChatProvider struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIChatProvider talks to the OpenAI API, or to any OpenAI-compatible
+// server when baseURL is set. The API key is only required for the former.
+func NewOpenAIChatProvider(apiKey, baseURL, model string, httpClient *http.Client) (*OpenAIChatProvider, error) {
+	if apiKey == "" && baseURL == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable is not set")
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+	return &OpenAIChatProvider{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}, nil
+}
+
+func (p *OpenAIChatProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (string, error) {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     pickModel(p.model, req.Model),
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	PerspectiveFirstPerson = "first"
+	PerspectiveThirdPerson = "third"
+)
+
+// Persona describes the creator a description is written for: whose voice
+// it uses and which names the transcription tends to get wrong.
+type Persona struct {
+	ChannelName string `yaml:"channel_name"`
+	// Perspective is "first" (the creator speaking) or "third" (about the
+	// creator). Empty means first person.
+	Perspective string `yaml:"perspective"`
+	Tone        string `yaml:"tone"`
+	// Vocabulary lists names and terms to correct when misrecognized.
+	Vocabulary []string `yaml:"vocabulary"`
+}
+
+// PersonaFor returns the persona for a video given its slash-separated path
+// relative to the processed directory. The deepest matching entry of
+// PersonaDirs wins; otherwise the run's Persona applies. No configured
+// persona yields a neutral, first-person one.
+func (c Config) PersonaFor(relativePath string) (Persona, error) {
+	name := c.Persona
+	longest := -1
+	dir := path.Dir(relativePath)
+	for prefix, persona := range c.PersonaDirs {
+		prefix = strings.Trim(path.Clean("/"+prefix), "/")
+		if prefix != "" && dir != prefix && !strings.HasPrefix(dir, prefix+"/") {
+			continue
+		}
+		if len(prefix) > longest {
+			longest = len(prefix)
+			name = persona
+		}
+	}
+
+	if name == "" {
+		return Persona{}, nil
+	}
+	persona, ok := c.Personas[name]
+	if !ok {
+		return Persona{}, fmt.Errorf("unknown persona '%s'", name)
+	}
+	return persona, nil
+}
+
+// Terms returns the channel name followed by the vocabulary, the names the
+// description prompt asks to correct.
+func (p Persona) Terms() []string {
+	terms := p.Vocabulary
+	if p.ChannelName != "" && !containsFold(terms, p.ChannelName) {
+		terms = append([]string{p.ChannelName}, terms...)
+	}
+	return terms
+}
+
+func (p Persona) validate() error {
+	switch p.Perspective {
+	case "", PerspectiveFirstPerson, PerspectiveThirdPerson:
+		return nil
+	default:
+		return fmt.Errorf("invalid perspective '%s': expected first or third", p.Perspective)
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package utils
+
+import "os/exec"
+
+// ownProcessGroup does nothing where process groups are not available.
+func ownProcessGroup(cmd *exec.Cmd) {}
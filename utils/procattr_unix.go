@@ -0,0 +1,16 @@
+//go:build unix
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ownProcessGroup starts cmd in a process group of its own, so a Ctrl-C in
+// the terminal reaches only this program. The first Ctrl-C then lets
+// ffmpeg and whisper.cpp finish the current stage instead of killing them;
+// cancelling the context still does.
+func ownProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Prompt template names. The built-in versions live in prompts/; a file with
+// the same name in Config.PromptsDir replaces the built-in one.
+const (
+	PromptDescriptionSystem = "description_system.tmpl"
+	PromptDescriptionUser   = "description_user.tmpl"
+	PromptEvaluationSystem  = "evaluation_system.tmpl"
+	PromptEvaluationUser    = "evaluation_user.tmpl"
+	PromptSummarySystem     = "summary_system.tmpl"
+	PromptSummaryUser       = "summary_user.tmpl"
+)
+
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// PromptData holds the variables available to every prompt template. Fields
+// that make no sense for a prompt are left empty.
+type PromptData struct {
+	Language      string
+	Filename      string
+	Transcription string
+	MaxLength     int
+	Persona       Persona
+	// Speakers are the labels (S1, S2, ...) of a diarized transcription.
+	Speakers     []string
+	Descriptions []string
+	// Text is the chunk of transcription being summarized.
+	Text string
+}
+
+type Prompts struct {
+	templates map[string]*template.Template
+}
+
+var promptFuncs = template.FuncMap{
+	"join": strings.Join,
+	"inc":  func(i int) int { return i + 1 },
+}
+
+// LoadPrompts parses the built-in prompt templates, replacing any that have
+// an override in dir. An empty dir uses only the built-in templates.
+func LoadPrompts(dir string) (*Prompts, error) {
+	entries, err := defaultPrompts.ReadDir("prompts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in prompts: %v", err)
+	}
+
+	prompts := &Prompts{templates: make(map[string]*template.Template)}
+	for _, entry := range entries {
+		name := entry.Name()
+		content, err := defaultPrompts.ReadFile("prompts/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read built-in prompt '%s': %v", name, err)
+		}
+
+		if dir != "" {
+			override, err := os.ReadFile(filepath.Join(filepath.Clean(dir), name))
+			if err == nil {
+				content = override
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read prompt override '%s': %v", name, err)
+			}
+		}
+
+		tmpl, err := template.New(name).Funcs(promptFuncs).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt '%s': %v", name, err)
+		}
+		prompts.templates[name] = tmpl
+	}
+
+	return prompts, nil
+}
+
+// Render executes the named template with data.
+func (p *Prompts) Render(name string, data PromptData) (string, error) {
+	tmpl, ok := p.templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt '%s'", name)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt '%s': %v", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,421 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Results file formats accepted by NewResultsStore.
+const (
+	FormatXML    = "xml"
+	FormatJSON   = "json"
+	FormatJSONL  = "jsonl"
+	FormatSQLite = "sqlite"
+)
+
+// ResultsFormatVersion is recorded with results written by this version.
+// Results without it may still carry the escaping of earlier versions until
+// MigrateResults repairs them.
+const ResultsFormatVersion = 1
+
+// ResultsStore persists TranscriptionResults keyed by their normalized
+// VideoFile path.
+type ResultsStore interface {
+	// Load returns every stored result.
+	Load() (TranscriptionResults, error)
+	// Get returns the result stored for videoFile, if any.
+	Get(videoFile string) (TranscriptionResult, bool, error)
+	// Sources returns the fingerprint of every result that has one, keyed
+	// by VideoFile, without loading the results themselves.
+	Sources() (map[string]Fingerprint, error)
+	// FindByHash returns the results whose source has the given content
+	// hash.
+	FindByHash(hash string) ([]TranscriptionResult, error)
+	// Put inserts or replaces the result for each VideoFile and persists
+	// them together before returning.
+	Put(results ...TranscriptionResult) error
+	// Delete removes the result stored for videoFile, if any.
+	Delete(videoFile string) error
+	// FormatVersion returns the ResultsFormatVersion the stored results are
+	// in, 0 for results written before versions were recorded.
+	FormatVersion() (int, error)
+	// SetFormatVersion records the version once the results are in it.
+	SetFormatVersion(version int) error
+	Close() error
+}
+
+// NewResultsStore opens the results file at path. format is one of xml,
+// json, jsonl or sqlite; when empty it is inferred from the file extension
+// and defaults to xml.
+func NewResultsStore(path string, format string) (ResultsStore, error) {
+	if format == "" {
+		format = FormatFromExtension(path)
+	}
+
+	var codec resultsCodec
+	switch strings.ToLower(format) {
+	case FormatSQLite:
+		return NewSQLiteStore(path)
+	case FormatXML:
+		codec = xmlCodec{}
+	case FormatJSON:
+		codec = jsonCodec{}
+	case FormatJSONL:
+		codec = jsonlCodec{}
+	default:
+		return nil, fmt.Errorf("unsupported results format '%s'", format)
+	}
+
+	store := &fileStore{
+		path:  path,
+		codec: codec,
+		index: make(map[string]int),
+	}
+	if err := store.read(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// FormatFromExtension maps .json to json, .jsonl and .ndjson to jsonl, .db,
+// .sqlite and .sqlite3 to sqlite and anything else to xml.
+func FormatFromExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".db", ".sqlite", ".sqlite3":
+		return FormatSQLite
+	default:
+		return FormatXML
+	}
+}
+
+type resultsCodec interface {
+	encode(w io.Writer, results TranscriptionResults) error
+	decode(r io.Reader) (TranscriptionResults, error)
+	// salvage returns every complete result before the point where r stops
+	// being valid.
+	salvage(r io.Reader) TranscriptionResults
+}
+
+// fileStore keeps all results in memory and rewrites the whole file on
+// every Put. Writes are atomic and the previous file is kept as a backup.
+// JSONL files have nowhere to record a format version, so they always read
+// as version 0.
+type fileStore struct {
+	path    string
+	codec   resultsCodec
+	results TranscriptionResults
+	index   map[string]int
+}
+
+func (s *fileStore) read() error {
+	file, err := os.Open(filepath.Clean(s.path))
+	if os.IsNotExist(err) {
+		// Nothing older than the current format can end up in a new file
+		s.results.Version = ResultsFormatVersion
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open existing results file: %v", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Printf("Failed to close results file: %v\n", err)
+		}
+	}()
+
+	results, err := s.codec.decode(file)
+	if err != nil {
+		results, err = s.recover(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Normalize paths in existing results
+	for i := range results.Results {
+		results.Results[i].VideoFile = filepath.ToSlash(filepath.Clean(results.Results[i].VideoFile))
+		results.Results[i].AudioFile = filepath.ToSlash(filepath.Clean(results.Results[i].AudioFile))
+		s.index[results.Results[i].VideoFile] = i
+	}
+	s.results = results
+	return nil
+}
+
+// recover rebuilds the results of a damaged file from whatever complete
+// results it still holds, filling gaps from the backup, and writes them
+// back before returning, so they survive runs that never save anything.
+// The damaged file is moved aside first so that write cannot rotate it into
+// the backup; it is put back if the write fails.
+func (s *fileStore) recover(decodeErr error) (TranscriptionResults, error) {
+	var results TranscriptionResults
+	if data, err := os.ReadFile(filepath.Clean(s.path)); err == nil {
+		results = s.codec.salvage(bytes.NewReader(data))
+	}
+	salvaged := len(results.Results)
+
+	restored := 0
+	if data, err := os.ReadFile(filepath.Clean(BackupPath(s.path))); err == nil {
+		seen := make(map[string]bool, len(results.Results))
+		for _, result := range results.Results {
+			seen[result.VideoFile] = true
+		}
+		for _, result := range s.codec.salvage(bytes.NewReader(data)).Results {
+			if !seen[result.VideoFile] {
+				results.Results = append(results.Results, result)
+				restored++
+			}
+		}
+	}
+
+	if len(results.Results) == 0 {
+		return TranscriptionResults{}, fmt.Errorf("failed to decode existing results in '%s': %v", s.path, decodeErr)
+	}
+
+	damaged := s.path + ".corrupt"
+	if err := os.Rename(filepath.Clean(s.path), filepath.Clean(damaged)); err != nil {
+		return TranscriptionResults{}, fmt.Errorf("failed to move damaged results file aside: %v", err)
+	}
+	err := writeFileAtomic(s.path, func(w io.Writer) error {
+		return s.codec.encode(w, results)
+	})
+	if err != nil {
+		if err := os.Rename(filepath.Clean(damaged), filepath.Clean(s.path)); err != nil {
+			fmt.Printf("Failed to put damaged results file back: %v\n", err)
+		}
+		return TranscriptionResults{}, fmt.Errorf("failed to save recovered results to '%s': %v", s.path, err)
+	}
+	fmt.Printf("Results file '%s' is damaged (%v); recovered %d result(s) from it and %d from the backup, original kept as '%s'\n",
+		s.path, decodeErr, salvaged, restored, damaged)
+	return results, nil
+}
+
+func (s *fileStore) Load() (TranscriptionResults, error) {
+	return s.results, nil
+}
+
+func (s *fileStore) Get(videoFile string) (TranscriptionResult, bool, error) {
+	i, ok := s.index[videoFile]
+	if !ok {
+		return TranscriptionResult{}, false, nil
+	}
+	return s.results.Results[i], true, nil
+}
+
+func (s *fileStore) Sources() (map[string]Fingerprint, error) {
+	sources := make(map[string]Fingerprint)
+	for _, result := range s.results.Results {
+		if result.Source != nil {
+			sources[result.VideoFile] = *result.Source
+		}
+	}
+	return sources, nil
+}
+
+func (s *fileStore) FindByHash(hash string) ([]TranscriptionResult, error) {
+	var found []TranscriptionResult
+	for _, result := range s.results.Results {
+		if result.Source != nil && result.Source.Hash == hash {
+			found = append(found, result)
+		}
+	}
+	return found, nil
+}
+
+func (s *fileStore) Put(results ...TranscriptionResult) error {
+	for _, result := range results {
+		if i, ok := s.index[result.VideoFile]; ok {
+			s.results.Results[i] = result
+		} else {
+			s.index[result.VideoFile] = len(s.results.Results)
+			s.results.Results = append(s.results.Results, result)
+		}
+	}
+	return s.write()
+}
+
+func (s *fileStore) Delete(videoFile string) error {
+	i, ok := s.index[videoFile]
+	if !ok {
+		return nil
+	}
+	s.results.Results = slices.Delete(s.results.Results, i, i+1)
+	delete(s.index, videoFile)
+	for j := i; j < len(s.results.Results); j++ {
+		s.index[s.results.Results[j].VideoFile] = j
+	}
+	return s.write()
+}
+
+func (s *fileStore) FormatVersion() (int, error) {
+	return s.results.Version, nil
+}
+
+func (s *fileStore) SetFormatVersion(version int) error {
+	if s.results.Version == version {
+		return nil
+	}
+	s.results.Version = version
+	return s.write()
+}
+
+func (s *fileStore) write() error {
+	err := writeFileAtomic(s.path, func(w io.Writer) error {
+		if err := s.codec.encode(w, s.results); err != nil {
+			return fmt.Errorf("failed to encode results to '%s': %v", s.path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Results written to %s\n", s.path)
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) encode(w io.Writer, results TranscriptionResults) error {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		return err
+	}
+
+	// Make sure to flush the encoder
+	return encoder.Flush()
+}
+
+func (xmlCodec) decode(r io.Reader) (TranscriptionResults, error) {
+	var results TranscriptionResults
+	err := xml.NewDecoder(r).Decode(&results)
+	return results, err
+}
+
+func (xmlCodec) salvage(r io.Reader) TranscriptionResults {
+	var results TranscriptionResults
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return results
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "TranscriptionResult" {
+			continue
+		}
+		var result TranscriptionResult
+		if err := decoder.DecodeElement(&result, &start); err != nil {
+			return results
+		}
+		results.Results = append(results.Results, result)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) encode(w io.Writer, results TranscriptionResults) error {
+	if results.Results == nil {
+		results.Results = []TranscriptionResult{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+func (jsonCodec) decode(r io.Reader) (TranscriptionResults, error) {
+	var results TranscriptionResults
+	err := json.NewDecoder(r).Decode(&results)
+	if err == io.EOF {
+		err = nil
+	}
+	return results, err
+}
+
+func (jsonCodec) salvage(r io.Reader) TranscriptionResults {
+	var results TranscriptionResults
+	decoder := json.NewDecoder(r)
+
+	// Skip ahead to the opening bracket of the results array
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return results
+		}
+		if token == json.Delim('[') {
+			break
+		}
+	}
+	for decoder.More() {
+		var result TranscriptionResult
+		if err := decoder.Decode(&result); err != nil {
+			return results
+		}
+		results.Results = append(results.Results, result)
+	}
+	return results
+}
+
+// jsonlCodec writes one result per line so the file can be streamed.
+type jsonlCodec struct{}
+
+func (jsonlCodec) encode(w io.Writer, results TranscriptionResults) error {
+	encoder := json.NewEncoder(w)
+	for _, result := range results.Results {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (jsonlCodec) decode(r io.Reader) (TranscriptionResults, error) {
+	var results TranscriptionResults
+	scanner := bufio.NewScanner(r)
+	// Transcriptions of long videos easily exceed the default line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var result TranscriptionResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return TranscriptionResults{}, fmt.Errorf("line %d: %v", line, err)
+		}
+		results.Results = append(results.Results, result)
+	}
+	return results, scanner.Err()
+}
+
+// salvage keeps every line that parses, which drops a line cut short by a
+// crash along with any garbage.
+func (jsonlCodec) salvage(r io.Reader) TranscriptionResults {
+	var results TranscriptionResults
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var result TranscriptionResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err == nil && result.VideoFile != "" {
+			results.Results = append(results.Results, result)
+		}
+	}
+	return results
+}
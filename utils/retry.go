@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides how often and how long to wait before repeating a
+// request that failed for a transient reason: HTTP 429, any 5xx status or a
+// network error. A Retry-After header from the server takes precedence over
+// the computed backoff when it asks for a longer wait.
+type RetryPolicy struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	BaseDelay   time.Duration `yaml:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay"`
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    time.Minute,
+	}
+}
+
+// Client returns an HTTP client that retries according to the policy. All
+// API clients share it, so transcription and chat calls behave the same.
+func (p RetryPolicy) Client() *http.Client {
+	return &http.Client{
+		Transport: &retryTransport{
+			policy: p,
+			base:   http.DefaultTransport,
+		},
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based):
+// a random duration between half and all of BaseDelay*2^(attempt-1), capped
+// at MaxDelay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+type retryTransport struct {
+	policy RetryPolicy
+	base   http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// A body that cannot be replayed can only be sent once
+	replayable := req.Body == nil || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %v", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+
+		var reason string
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			reason = err.Error()
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			reason = resp.Status
+			wait = parseRetryAfter(resp.Header.Get("Retry-After"))
+		default:
+			return resp, nil
+		}
+
+		if !replayable || attempt >= t.policy.MaxAttempts {
+			return resp, err
+		}
+
+		if backoff := t.policy.backoff(attempt); backoff > wait {
+			wait = backoff
+		}
+		if resp != nil {
+			// Drain so the connection can be reused for the next attempt
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		fmt.Printf("Request to %s failed (%s), retrying in %s (attempt %d/%d)\n", req.URL.Host, reason, wait.Round(time.Millisecond), attempt+1, t.policy.MaxAttempts)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter understands both forms of the header: a number of seconds
+// or an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
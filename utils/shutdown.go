@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStopped is returned when a run ended early because a graceful stop was
+// requested. Everything finished until then has been saved and the next run
+// resumes from there.
+var ErrStopped = errors.New("stopped before all work was done")
+
+type stopKey struct{}
+
+// WithGracefulStop returns a context carrying a stop request. Once stop is
+// called, ProcessDirectory, ProcessFile and the stage commands start no new
+// video or stage and return ErrStopped after saving what they finished; ctx
+// itself stays alive so in-flight calls complete. Cancel ctx to abort those
+// too.
+func WithGracefulStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	stopCtx, stop := context.WithCancel(context.Background())
+	return context.WithValue(ctx, stopKey{}, stopCtx), stop
+}
+
+// stopping returns a channel closed once a graceful stop was requested, or
+// nil when ctx cannot be stopped gracefully.
+func stopping(ctx context.Context) <-chan struct{} {
+	if stopCtx, ok := ctx.Value(stopKey{}).(context.Context); ok {
+		return stopCtx.Done()
+	}
+	return nil
+}
+
+// stopRequested reports whether a graceful stop was requested for ctx.
+func stopRequested(ctx context.Context) bool {
+	select {
+	case <-stopping(ctx):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,403 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure-Go "sqlite" driver
+)
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how
+// many have run. Only ever append to this list.
+var sqliteMigrations = []string{
+	`CREATE TABLE results (
+		video_file TEXT PRIMARY KEY,
+		audio_file TEXT NOT NULL DEFAULT '',
+		transcription TEXT NOT NULL DEFAULT '',
+		best_description_index INTEGER NOT NULL DEFAULT 0,
+		error_stage TEXT,
+		error_message TEXT
+	);
+	CREATE TABLE descriptions (
+		video_file TEXT NOT NULL REFERENCES results(video_file) ON DELETE CASCADE,
+		number INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		PRIMARY KEY (video_file, number)
+	);
+	CREATE TABLE segments (
+		video_file TEXT NOT NULL REFERENCES results(video_file) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		start_seconds REAL NOT NULL,
+		end_seconds REAL NOT NULL,
+		text TEXT NOT NULL,
+		PRIMARY KEY (video_file, position)
+	);`,
+	`ALTER TABLE results ADD COLUMN source_size INTEGER;
+	ALTER TABLE results ADD COLUMN source_modified TEXT;
+	ALTER TABLE results ADD COLUMN source_hash TEXT;`,
+	`ALTER TABLE segments ADD COLUMN speaker TEXT NOT NULL DEFAULT '';`,
+	`CREATE INDEX results_source_hash ON results (source_hash);`,
+	`CREATE TABLE results_format (version INTEGER NOT NULL);
+	INSERT INTO results_format (version) VALUES (0);`,
+}
+
+// resultColumns are read by scanResult in this order.
+const resultColumns = `video_file, audio_file, transcription, best_description_index, error_stage, error_message, source_size, source_modified, source_hash`
+
+// SQLiteStore keeps one row per video, so saving a result touches only
+// that video's rows and each Put is a single transaction.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates the database at path and brings its
+// schema up to date.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := "file:" + url.PathEscape(path) + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database '%s': %v", path, err)
+	}
+	// A single connection avoids SQLITE_BUSY between our own goroutines
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{db: db}
+	if err := store.migrate(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to prepare SQLite database '%s': %v", path, err)
+	}
+	return store, nil
+}
+
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	// Nothing older than the current format can end up in a new database
+	if version == 0 {
+		return s.SetFormatVersion(ResultsFormatVersion)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Load() (TranscriptionResults, error) {
+	var results TranscriptionResults
+	index := make(map[string]int)
+
+	rows, err := s.db.Query(`SELECT ` + resultColumns + ` FROM results ORDER BY rowid`)
+	if err != nil {
+		return TranscriptionResults{}, fmt.Errorf("failed to query results: %v", err)
+	}
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			_ = rows.Close()
+			return TranscriptionResults{}, err
+		}
+		index[result.VideoFile] = len(results.Results)
+		results.Results = append(results.Results, result)
+	}
+	if err := closeRows(rows); err != nil {
+		return TranscriptionResults{}, err
+	}
+
+	// Attach children in bulk rather than querying once per video
+	rows, err = s.db.Query(`SELECT video_file, number, content FROM descriptions ORDER BY video_file, number`)
+	if err != nil {
+		return TranscriptionResults{}, fmt.Errorf("failed to query descriptions: %v", err)
+	}
+	for rows.Next() {
+		var videoFile string
+		var desc Description
+		if err := rows.Scan(&videoFile, &desc.Number, &desc.Content); err != nil {
+			_ = rows.Close()
+			return TranscriptionResults{}, fmt.Errorf("failed to read description: %v", err)
+		}
+		if i, ok := index[videoFile]; ok {
+			results.Results[i].Descriptions = append(results.Results[i].Descriptions, desc)
+		}
+	}
+	if err := closeRows(rows); err != nil {
+		return TranscriptionResults{}, err
+	}
+
+	rows, err = s.db.Query(`SELECT video_file, start_seconds, end_seconds, speaker, text FROM segments ORDER BY video_file, position`)
+	if err != nil {
+		return TranscriptionResults{}, fmt.Errorf("failed to query segments: %v", err)
+	}
+	for rows.Next() {
+		var videoFile string
+		var seg Segment
+		if err := rows.Scan(&videoFile, &seg.Start, &seg.End, &seg.Speaker, &seg.Text); err != nil {
+			_ = rows.Close()
+			return TranscriptionResults{}, fmt.Errorf("failed to read segment: %v", err)
+		}
+		if i, ok := index[videoFile]; ok {
+			results.Results[i].Segments = append(results.Results[i].Segments, seg)
+		}
+	}
+	if err := closeRows(rows); err != nil {
+		return TranscriptionResults{}, err
+	}
+
+	return results, nil
+}
+
+func (s *SQLiteStore) Get(videoFile string) (TranscriptionResult, bool, error) {
+	row := s.db.QueryRow(`SELECT `+resultColumns+` FROM results WHERE video_file = ?`, videoFile)
+	result, err := scanResult(row)
+	if err == sql.ErrNoRows {
+		return TranscriptionResult{}, false, nil
+	}
+	if err != nil {
+		return TranscriptionResult{}, false, err
+	}
+
+	rows, err := s.db.Query(`SELECT number, content FROM descriptions WHERE video_file = ? ORDER BY number`, videoFile)
+	if err != nil {
+		return TranscriptionResult{}, false, fmt.Errorf("failed to query descriptions: %v", err)
+	}
+	for rows.Next() {
+		var desc Description
+		if err := rows.Scan(&desc.Number, &desc.Content); err != nil {
+			_ = rows.Close()
+			return TranscriptionResult{}, false, fmt.Errorf("failed to read description: %v", err)
+		}
+		result.Descriptions = append(result.Descriptions, desc)
+	}
+	if err := closeRows(rows); err != nil {
+		return TranscriptionResult{}, false, err
+	}
+
+	rows, err = s.db.Query(`SELECT start_seconds, end_seconds, speaker, text FROM segments WHERE video_file = ? ORDER BY position`, videoFile)
+	if err != nil {
+		return TranscriptionResult{}, false, fmt.Errorf("failed to query segments: %v", err)
+	}
+	for rows.Next() {
+		var seg Segment
+		if err := rows.Scan(&seg.Start, &seg.End, &seg.Speaker, &seg.Text); err != nil {
+			_ = rows.Close()
+			return TranscriptionResult{}, false, fmt.Errorf("failed to read segment: %v", err)
+		}
+		result.Segments = append(result.Segments, seg)
+	}
+	if err := closeRows(rows); err != nil {
+		return TranscriptionResult{}, false, err
+	}
+
+	return result, true, nil
+}
+
+func (s *SQLiteStore) Sources() (map[string]Fingerprint, error) {
+	rows, err := s.db.Query(`SELECT video_file, source_size, source_modified, source_hash FROM results WHERE source_size IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fingerprints: %v", err)
+	}
+	sources := make(map[string]Fingerprint)
+	for rows.Next() {
+		var videoFile, modified string
+		var source Fingerprint
+		var hash sql.NullString
+		if err := rows.Scan(&videoFile, &source.Size, &modified, &hash); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to read fingerprint: %v", err)
+		}
+		if source.ModTime, err = time.Parse(time.RFC3339Nano, modified); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to read modification time of '%s': %v", videoFile, err)
+		}
+		source.Hash = hash.String
+		sources[videoFile] = source
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// FindByHash looks up the matching videos through the source_hash index
+// and then reads each one with Get.
+func (s *SQLiteStore) FindByHash(hash string) ([]TranscriptionResult, error) {
+	rows, err := s.db.Query(`SELECT video_file FROM results WHERE source_hash = ? ORDER BY rowid`, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results by hash: %v", err)
+	}
+	var videoFiles []string
+	for rows.Next() {
+		var videoFile string
+		if err := rows.Scan(&videoFile); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to read result: %v", err)
+		}
+		videoFiles = append(videoFiles, videoFile)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+
+	var found []TranscriptionResult
+	for _, videoFile := range videoFiles {
+		result, ok, err := s.Get(videoFile)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, result)
+		}
+	}
+	return found, nil
+}
+
+func (s *SQLiteStore) Put(results ...TranscriptionResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	for _, result := range results {
+		if err := putResult(tx, result); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to save '%s': %v", result.VideoFile, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit results: %v", err)
+	}
+	return nil
+}
+
+// Delete relies on ON DELETE CASCADE to remove descriptions and segments.
+func (s *SQLiteStore) Delete(videoFile string) error {
+	if _, err := s.db.Exec(`DELETE FROM results WHERE video_file = ?`, videoFile); err != nil {
+		return fmt.Errorf("failed to delete '%s': %v", videoFile, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) FormatVersion() (int, error) {
+	var version int
+	if err := s.db.QueryRow(`SELECT version FROM results_format`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read results format version: %v", err)
+	}
+	return version, nil
+}
+
+func (s *SQLiteStore) SetFormatVersion(version int) error {
+	if _, err := s.db.Exec(`UPDATE results_format SET version = ?`, version); err != nil {
+		return fmt.Errorf("failed to record results format version: %v", err)
+	}
+	return nil
+}
+
+func putResult(tx *sql.Tx, result TranscriptionResult) error {
+	var errorStage, errorMessage sql.NullString
+	if result.Error != nil {
+		errorStage = sql.NullString{String: result.Error.Stage, Valid: true}
+		errorMessage = sql.NullString{String: result.Error.Message, Valid: true}
+	}
+	var sourceSize sql.NullInt64
+	var sourceModified, sourceHash sql.NullString
+	if result.Source != nil {
+		sourceSize = sql.NullInt64{Int64: result.Source.Size, Valid: true}
+		sourceModified = sql.NullString{String: result.Source.ModTime.UTC().Format(time.RFC3339Nano), Valid: true}
+		sourceHash = sql.NullString{String: result.Source.Hash, Valid: true}
+	}
+
+	_, err := tx.Exec(`INSERT INTO results (`+resultColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (video_file) DO UPDATE SET
+			audio_file = excluded.audio_file,
+			transcription = excluded.transcription,
+			best_description_index = excluded.best_description_index,
+			error_stage = excluded.error_stage,
+			error_message = excluded.error_message,
+			source_size = excluded.source_size,
+			source_modified = excluded.source_modified,
+			source_hash = excluded.source_hash`,
+		result.VideoFile, result.AudioFile, result.Transcription, result.BestDescriptionIndex, errorStage, errorMessage, sourceSize, sourceModified, sourceHash)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM descriptions WHERE video_file = ?`, result.VideoFile); err != nil {
+		return err
+	}
+	for _, desc := range result.Descriptions {
+		if _, err := tx.Exec(`INSERT INTO descriptions (video_file, number, content) VALUES (?, ?, ?)`, result.VideoFile, desc.Number, desc.Content); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM segments WHERE video_file = ?`, result.VideoFile); err != nil {
+		return err
+	}
+	for i, seg := range result.Segments {
+		if _, err := tx.Exec(`INSERT INTO segments (video_file, position, start_seconds, end_seconds, speaker, text) VALUES (?, ?, ?, ?, ?, ?)`, result.VideoFile, i, seg.Start, seg.End, seg.Speaker, seg.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanResult(row rowScanner) (TranscriptionResult, error) {
+	var result TranscriptionResult
+	var errorStage, errorMessage sql.NullString
+	var sourceSize sql.NullInt64
+	var sourceModified, sourceHash sql.NullString
+	err := row.Scan(&result.VideoFile, &result.AudioFile, &result.Transcription, &result.BestDescriptionIndex, &errorStage, &errorMessage, &sourceSize, &sourceModified, &sourceHash)
+	if err == sql.ErrNoRows {
+		return TranscriptionResult{}, err
+	}
+	if err != nil {
+		return TranscriptionResult{}, fmt.Errorf("failed to read result: %v", err)
+	}
+	if errorStage.Valid {
+		result.Error = &ProcessingError{Stage: errorStage.String, Message: errorMessage.String}
+	}
+	if sourceSize.Valid {
+		modTime, err := time.Parse(time.RFC3339Nano, sourceModified.String)
+		if err != nil {
+			return TranscriptionResult{}, fmt.Errorf("failed to read modification time of '%s': %v", result.VideoFile, err)
+		}
+		result.Source = &Fingerprint{Size: sourceSize.Int64, ModTime: modTime, Hash: sourceHash.String}
+	}
+	return result, nil
+}
+
+func closeRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return fmt.Errorf("failed to read rows: %v", err)
+	}
+	return rows.Close()
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// RegenerateDescriptions replaces the descriptions of stored results that
+// have a transcription with cfg.Descriptions.Count new ones. The new
+// descriptions are unranked until RerankDescriptions runs. videos limits
+// the run to those result paths; when empty every result is used. It
+// returns the number of results updated.
+func RegenerateDescriptions(ctx context.Context, store ResultsStore, cfg Config, generator DescriptionGenerator, videos []string) (int, error) {
+	results, err := selectResults(store, videos)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, result := range results {
+		if stopRequested(ctx) {
+			return updated, ErrStopped
+		}
+		if result.Transcription == "" {
+			fmt.Printf("No transcription stored for '%s', skipping\n", result.VideoFile)
+			continue
+		}
+
+		err := regenerate(ctx, &result, cfg, generator)
+		if err != nil && ctx.Err() != nil {
+			// Cancellation is not a failure of this video
+			return updated, err
+		}
+		if err := finishStage(store, &result, StageGenerate, err, cfg.Processing.KeepGoing); err != nil {
+			return updated, err
+		}
+		updated++
+		fmt.Printf("Generated %d description(s) for '%s'\n", len(result.Descriptions), result.VideoFile)
+	}
+	return updated, nil
+}
+
+// regenerate replaces the descriptions of result with freshly generated,
+// unranked ones.
+func regenerate(ctx context.Context, result *TranscriptionResult, cfg Config, generator DescriptionGenerator) error {
+	persona, err := cfg.PersonaFor(result.VideoFile)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := cfg.Timeouts.stageContext(ctx, StageGenerate)
+	defer cancel()
+	descriptions, err := generator.GenerateDescriptions(ctx, newDescriptionRequest(*result, persona), cfg.Descriptions.Count)
+	if err != nil {
+		return err
+	}
+
+	result.Descriptions = make([]Description, len(descriptions))
+	for i, desc := range descriptions {
+		result.Descriptions[i] = Description{Number: i + 1, Content: desc}
+	}
+	result.BestDescriptionIndex = 0
+	return nil
+}
+
+// RerankDescriptions asks the evaluator for the best of the stored
+// descriptions of each result again. videos limits the run like for
+// RegenerateDescriptions. It returns the number of results updated.
+func RerankDescriptions(ctx context.Context, store ResultsStore, cfg Config, evaluator DescriptionEvaluator, videos []string) (int, error) {
+	results, err := selectResults(store, videos)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, result := range results {
+		if stopRequested(ctx) {
+			return updated, ErrStopped
+		}
+		if len(result.Descriptions) == 0 {
+			fmt.Printf("No descriptions stored for '%s', skipping\n", result.VideoFile)
+			continue
+		}
+
+		stageCtx, cancel := cfg.Timeouts.stageContext(ctx, StageEvaluate)
+		bestIndex, err := evaluator.EvaluateDescriptions(stageCtx, getDescriptionContents(result.Descriptions), result.Transcription, filepath.Base(result.VideoFile))
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			return updated, err
+		}
+		if err == nil {
+			result.BestDescriptionIndex = bestIndex
+		}
+		if err := finishStage(store, &result, StageEvaluate, err, cfg.Processing.KeepGoing); err != nil {
+			return updated, err
+		}
+		updated++
+		fmt.Printf("Best description for '%s': %d\n", result.VideoFile, result.BestDescriptionIndex)
+	}
+	return updated, nil
+}
+
+// finishStage persists result after stage ran. A stage error is returned,
+// or with keepGoing recorded on the result; success clears an error the
+// same stage left earlier.
+func finishStage(store ResultsStore, result *TranscriptionResult, stage string, stageErr error, keepGoing bool) error {
+	if stageErr != nil {
+		if !keepGoing {
+			return fmt.Errorf("failed to %s '%s': %v", stage, result.VideoFile, stageErr)
+		}
+		fmt.Printf("Failed to %s '%s', continuing: %v\n", stage, result.VideoFile, stageErr)
+		result.Error = &ProcessingError{Stage: stage, Message: stageErr.Error()}
+	} else if result.Error != nil && result.Error.Stage == stage {
+		result.Error = nil
+	}
+
+	if err := store.Put(*result); err != nil {
+		return fmt.Errorf("failed to save results: %v", err)
+	}
+	return nil
+}
+
+// selectResults returns the stored results for videos, or every stored
+// result when videos is empty.
+func selectResults(store ResultsStore, videos []string) ([]TranscriptionResult, error) {
+	if len(videos) == 0 {
+		results, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		return results.Results, nil
+	}
+
+	results := make([]TranscriptionResult, 0, len(videos))
+	for _, video := range videos {
+		video = filepath.ToSlash(filepath.Clean(video))
+		result, ok, err := store.Get(video)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up '%s': %v", video, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("no result stored for '%s'", video)
+		}
+		result.Descriptions = slices.Clone(result.Descriptions)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ExportResults copies every result from src to dst in one write and
+// returns how many were copied. dst keeps the older of both format versions
+// so results that still need MigrateResults are not taken as repaired.
+func ExportResults(src, dst ResultsStore) (int, error) {
+	results, err := src.Load()
+	if err != nil {
+		return 0, err
+	}
+	if len(results.Results) == 0 {
+		return 0, nil
+	}
+	srcVersion, err := src.FormatVersion()
+	if err != nil {
+		return 0, err
+	}
+	dstVersion, err := dst.FormatVersion()
+	if err != nil {
+		return 0, err
+	}
+	if srcVersion < dstVersion {
+		if err := dst.SetFormatVersion(srcVersion); err != nil {
+			return 0, err
+		}
+	}
+	if err := dst.Put(results.Results...); err != nil {
+		return 0, err
+	}
+	return len(results.Results), nil
+}
+
+// Status summarizes how far the stored results have come.
+type Status struct {
+	Total int
+	// Complete results have every description and a best one picked.
+	Complete int
+	// NoAudio counts videos without an audio stream.
+	NoAudio int
+	// Transcribed results have fewer descriptions than configured.
+	Transcribed int
+	// Unranked results have descriptions but no best one yet.
+	Unranked int
+	// Failed counts results with an error, by stage.
+	Failed map[string]int
+	// Pending lists videos in the scanned directory without any result.
+	Pending []string
+}
+
+// CollectStatus tallies the results in store. With a rootDir it also lists
+// the videos under it that have no result yet.
+func CollectStatus(store ResultsStore, cfg Config, rootDir string) (Status, error) {
+	results, err := store.Load()
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{Failed: make(map[string]int)}
+	stored := make(map[string]bool, len(results.Results))
+	for _, result := range results.Results {
+		stored[result.VideoFile] = true
+		status.Total++
+		switch {
+		case result.Error != nil:
+			status.Failed[result.Error.Stage]++
+		case result.AudioFile == NoAudioFile:
+			status.NoAudio++
+		case len(result.Descriptions) < cfg.Descriptions.Count:
+			status.Transcribed++
+		case result.BestDescriptionIndex == 0:
+			status.Unranked++
+		default:
+			status.Complete++
+		}
+	}
+
+	if rootDir != "" {
+		videos, err := findVideos(rootDir)
+		if err != nil {
+			return Status{}, err
+		}
+		for _, video := range videos {
+			if !stored[video.relativePath] {
+				status.Pending = append(status.Pending, video.relativePath)
+			}
+		}
+		sort.Strings(status.Pending)
+	}
+	return status, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SubtitleFormatSRT = "srt"
+	SubtitleFormatVTT = "vtt"
+)
+
+// WriteSubtitles writes segments as a sidecar subtitle file next to
+// videoFile (video.mp4 -> video.srt) and returns the file's path.
+func WriteSubtitles(videoFile string, format string, segments []Segment) (string, error) {
+	var content string
+	switch format {
+	case SubtitleFormatSRT:
+		content = FormatSRT(segments)
+	case SubtitleFormatVTT:
+		content = FormatVTT(segments)
+	default:
+		return "", fmt.Errorf("unsupported subtitle format '%s'", format)
+	}
+
+	subtitleFile := strings.TrimSuffix(videoFile, filepath.Ext(videoFile)) + "." + format
+	if err := os.WriteFile(filepath.Clean(subtitleFile), []byte(content), 0600); err != nil {
+		return "", err
+	}
+	return subtitleFile, nil
+}
+
+func FormatSRT(segments []Segment) string {
+	var b strings.Builder
+	for i, seg := range segments {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(seg.Start, ","), formatTimestamp(seg.End, ","), seg.Text)
+	}
+	return b.String()
+}
+
+func FormatVTT(segments []Segment) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, seg := range segments {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", formatTimestamp(seg.Start, "."), formatTimestamp(seg.End, "."), seg.Text)
+	}
+	return b.String()
+}
+
+// formatTimestamp renders seconds as HH:MM:SS followed by the millisecond
+// separator ("," for SRT, "." for WebVTT) and milliseconds.
+func formatTimestamp(seconds float64, separator string) string {
+	millis := int64(seconds*1000 + 0.5)
+	if millis < 0 {
+		millis = 0
+	}
+	h := millis / 3600000
+	m := millis / 60000 % 60
+	s := millis / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, separator, millis%1000)
+}
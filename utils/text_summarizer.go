@@ -7,39 +7,34 @@ import (
 	"strings"
 
 	lingua "github.com/pemistahl/lingua-go"
-	openai "github.com/sashabaranov/go-openai"
-)
-
-const (
-	maxChunkSize    = 8000
-	targetChunkSize = 4000
-	maxIterations   = 10
 )
 
 type TextSummarizer struct {
-	client *openai.Client
+	provider ChatProvider
+	prompts  *Prompts
+	cfg      Config
 }
 
-func NewTextSummarizer(client *openai.Client) *TextSummarizer {
-	return &TextSummarizer{client: client}
+func NewTextSummarizer(provider ChatProvider, prompts *Prompts, cfg Config) *TextSummarizer {
+	return &TextSummarizer{provider: provider, prompts: prompts, cfg: cfg}
 }
 
-func (ts *TextSummarizer) SummarizeText(text string, targetLength int) (string, error) {
-	return ts.summarizeTextRecursive(text, targetLength, 0)
+func (ts *TextSummarizer) SummarizeText(ctx context.Context, text string, targetLength int) (string, error) {
+	return ts.summarizeTextRecursive(ctx, text, targetLength, 0)
 }
 
-func (ts *TextSummarizer) summarizeTextRecursive(text string, targetLength int, iteration int) (string, error) {
-	if len(text) <= targetLength || iteration >= maxIterations {
+func (ts *TextSummarizer) summarizeTextRecursive(ctx context.Context, text string, targetLength int, iteration int) (string, error) {
+	if len(text) <= targetLength || iteration >= ts.cfg.Summary.MaxIterations {
 		return text, nil
 	}
 
 	fmt.Printf("Summarization iteration %d: Input length %d characters\n", iteration, len(text))
 
-	chunks := ts.splitTextIntoChunks(text, maxChunkSize)
+	chunks := ts.splitTextIntoChunks(text, ts.cfg.Summary.MaxChunkSize)
 	summarizedChunks := make([]string, 0, len(chunks))
 
 	for i, chunk := range chunks {
-		summary, err := ts.summarizeChunk(chunk)
+		summary, err := ts.summarizeChunk(ctx, chunk)
 		if err != nil {
 			return "", fmt.Errorf("error summarizing chunk %d: %v", i, err)
 		}
@@ -50,42 +45,48 @@ func (ts *TextSummarizer) summarizeTextRecursive(text string, targetLength int,
 	fmt.Printf("Summarization iteration %d: Output length %d characters\n", iteration, len(combinedSummary))
 
 	if len(combinedSummary) > targetLength {
-		return ts.summarizeTextRecursive(combinedSummary, targetLength, iteration+1)
+		return ts.summarizeTextRecursive(ctx, combinedSummary, targetLength, iteration+1)
 	}
 
 	return combinedSummary, nil
 }
 
-func (ts *TextSummarizer) summarizeChunk(chunk string) (string, error) {
-	ctx := context.Background()
-
+func (ts *TextSummarizer) summarizeChunk(ctx context.Context, chunk string) (string, error) {
 	// Detect the language of the chunk
 	detector := lingua.NewLanguageDetectorBuilder().FromAllLanguages().Build()
 	language, _ := detector.DetectLanguageOf(chunk)
 
-	prompt := fmt.Sprintf("Summarize the following text in %s, maintaining key information and context:\n\n%s", language.String(), chunk)
+	data := PromptData{Language: language.String(), Text: chunk}
+	systemPrompt, err := ts.prompts.Render(PromptSummarySystem, data)
+	if err != nil {
+		return "", err
+	}
+	prompt, err := ts.prompts.Render(PromptSummaryUser, data)
+	if err != nil {
+		return "", err
+	}
 
-	req := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
-		Messages: []openai.ChatCompletionMessage{
+	req := ChatRequest{
+		Model: ts.cfg.Chat.SummaryModel,
+		Messages: []ChatMessage{
 			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: fmt.Sprintf("You are a helpful assistant that summarizes text concisely while retaining key information. Always respond in %s.", language.String()),
+				Role:    ChatRoleSystem,
+				Content: systemPrompt,
 			},
 			{
-				Role:    openai.ChatMessageRoleUser,
+				Role:    ChatRoleUser,
 				Content: prompt,
 			},
 		},
 		MaxTokens: 500,
 	}
 
-	resp, err := ts.client.CreateChatCompletion(ctx, req)
+	summary, err := ts.provider.CreateChatCompletion(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("error creating chat completion: %v", err)
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return summary, nil
 }
 
 func (ts *TextSummarizer) splitTextIntoChunks(text string, chunkSize int) []string {
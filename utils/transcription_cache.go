@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CachingTranscriber answers from an on-disk cache when the same audio was
+// transcribed before with the same parameters, and otherwise delegates to
+// Transcriber and caches its result. Entries are keyed by the PCM samples
+// only, so the same video under another name is a cache hit.
+type CachingTranscriber struct {
+	Transcriber AudioTranscriber
+	// Dir holds one JSON file per cached transcript.
+	Dir string
+	// Params names everything besides the audio that changes the transcript,
+	// such as the backend and model.
+	Params string
+}
+
+func (t *CachingTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error) {
+	key, err := t.cacheKey(audioFile, maxDuration, prompt)
+	if err != nil {
+		// The backend reports unreadable audio more usefully than we can
+		fmt.Printf("Not caching transcription of %s: %v\n", audioFile, err)
+		return t.Transcriber.TranscribeAudio(ctx, audioFile, maxDuration, prompt)
+	}
+	entry := filepath.Join(t.Dir, key[:2], key+".json")
+
+	if data, err := os.ReadFile(filepath.Clean(entry)); err == nil {
+		var transcript Transcript
+		if err := json.Unmarshal(data, &transcript); err == nil {
+			fmt.Printf("Using cached transcription for %s\n", audioFile)
+			return transcript, nil
+		}
+		fmt.Printf("Ignoring unreadable transcription cache entry %s\n", entry)
+	}
+
+	transcript, err := t.Transcriber.TranscribeAudio(ctx, audioFile, maxDuration, prompt)
+	if err != nil {
+		return Transcript{}, err
+	}
+
+	// A failure to cache must not cost the transcription itself
+	if err := os.MkdirAll(filepath.Dir(entry), 0750); err != nil {
+		fmt.Printf("Failed to create transcription cache directory: %v\n", err)
+		return transcript, nil
+	}
+	err = writeFileAtomic(entry, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(transcript)
+	})
+	if err != nil {
+		fmt.Printf("Failed to cache transcription of %s: %v\n", audioFile, err)
+	}
+	return transcript, nil
+}
+
+// cacheKey hashes the parameters, the chunk duration (it decides where
+// chunks are cut), the prompt and the audio samples.
+func (t *CachingTranscriber) cacheKey(audioFile string, maxDuration time.Duration, prompt string) (string, error) {
+	file, err := os.Open(filepath.Clean(audioFile))
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\nchunk_duration=%s\nprompt=%q\n", t.Params, maxDuration, prompt)
+	if err := copyWAVSamples(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyWAVSamples copies the payload of the data chunk of a RIFF/WAVE file,
+// skipping metadata chunks such as the encoder tag ffmpeg writes. Anything
+// that is not a WAV file is copied whole.
+func copyWAVSamples(w io.Writer, file *os.File) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.Copy(w, file)
+		return err
+	}
+
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			return fmt.Errorf("no data chunk in WAV file: %v", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		if string(chunk[0:4]) == "data" {
+			// Streamed WAVs may leave the size unset, so read to the end
+			_, err := io.Copy(w, file)
+			return err
+		}
+		// Chunks are padded to an even length
+		if _, err := file.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// WhisperServerTranscriber sends chunks to a self-hosted server exposing the
+// OpenAI-compatible /v1/audio/transcriptions endpoint, such as the
+// whisper.cpp server or faster-whisper-server.
+type WhisperServerTranscriber struct {
+	// Concurrency is the number of chunks sent to the server at once.
+	Concurrency int
+	// Sequential sends one chunk after another instead, each prompted with
+	// the end of the previous chunk's transcript.
+	Sequential bool
+
+	client *openai.Client
+	model  string
+}
+
+func NewWhisperServerTranscriber(baseURL, model string, httpClient *http.Client) *WhisperServerTranscriber {
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+	if model == "" {
+		model = openai.Whisper1
+	}
+
+	config := openai.DefaultConfig("")
+	config.BaseURL = strings.TrimSuffix(baseURL, "/") + "/v1"
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+	return &WhisperServerTranscriber{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}
+}
+
+func (t *WhisperServerTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error) {
+	return transcribeChunks(ctx, audioFile, maxDuration, t.Concurrency, t.Sequential, prompt, func(ctx context.Context, chunk, prompt string) (Transcript, error) {
+		resp, err := t.client.CreateTranscription(ctx, openai.AudioRequest{
+			Model:    t.model,
+			FilePath: chunk,
+			Prompt:   prompt,
+			Format:   openai.AudioResponseFormatVerboseJSON,
+		})
+		if err != nil {
+			return Transcript{}, err
+		}
+		return transcriptFromResponse(resp), nil
+	})
+}
+
+// WhisperCppTranscriber runs the whisper.cpp command-line binary on each
+// chunk, so no network access is needed at all.
+type WhisperCppTranscriber struct {
+	// Concurrency is the number of whisper.cpp processes run at once.
+	Concurrency int
+	// Sequential runs one chunk after another instead, each prompted with the
+	// end of the previous chunk's transcript.
+	Sequential bool
+
+	binary string
+	model  string
+}
+
+func NewWhisperCppTranscriber(binary, model string) (*WhisperCppTranscriber, error) {
+	if binary == "" {
+		binary = "whisper-cli"
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no whisper.cpp model configured (transcription.whisper_cpp_model or WHISPER_CPP_MODEL)")
+	}
+
+	return &WhisperCppTranscriber{
+		binary: binary,
+		model:  filepath.Clean(model),
+	}, nil
+}
+
+func (t *WhisperCppTranscriber) TranscribeAudio(ctx context.Context, audioFile string, maxDuration time.Duration, prompt string) (Transcript, error) {
+	return transcribeChunks(ctx, audioFile, maxDuration, t.Concurrency, t.Sequential, prompt, func(ctx context.Context, chunk, prompt string) (Transcript, error) {
+		// -np suppresses everything but the timestamped result lines
+		args := []string{"-m", t.model, "-f", chunk, "-l", "auto", "-np"}
+		if prompt != "" {
+			args = append(args, "--prompt", prompt)
+		}
+		// #nosec G204
+		cmd := exec.CommandContext(ctx, t.binary, args...)
+		ownProcessGroup(cmd)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return Transcript{}, fmt.Errorf("whisper.cpp error: %v\nStderr: %s", err, stderr.String())
+		}
+
+		return parseWhisperCppOutput(string(output)), nil
+	})
+}
+
+// whisperCppLine matches "[00:00:01.000 --> 00:00:04.500]   text".
+var whisperCppLine = regexp.MustCompile(`^\[(\d+):(\d+):(\d+(?:\.\d+)?) --> (\d+):(\d+):(\d+(?:\.\d+)?)\]\s*(.*)$`)
+
+func parseWhisperCppOutput(output string) Transcript {
+	var transcript Transcript
+	var texts []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		match := whisperCppLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		text := strings.TrimSpace(match[7])
+		if text == "" {
+			continue
+		}
+		transcript.Segments = append(transcript.Segments, Segment{
+			Start: parseClock(match[1], match[2], match[3]),
+			End:   parseClock(match[4], match[5], match[6]),
+			Text:  text,
+		})
+		texts = append(texts, text)
+	}
+	transcript.Text = strings.Join(texts, " ")
+	return transcript
+}
+
+func parseClock(hours, minutes, seconds string) float64 {
+	h, _ := strconv.ParseFloat(hours, 64)
+	m, _ := strconv.ParseFloat(minutes, 64)
+	s, _ := strconv.ParseFloat(seconds, 64)
+	return h*3600 + m*60 + s
+}
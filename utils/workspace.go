@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// NewWorkspace creates a private directory for the temporary files of one
+// run inside cfg.Processing.WorkDir, or the system temporary directory when
+// that is empty. Runs sharing a work directory never touch each other's
+// files.
+func NewWorkspace(cfg Config) (string, error) {
+	if cfg.Processing.WorkDir != "" {
+		if err := os.MkdirAll(cfg.Processing.WorkDir, 0750); err != nil {
+			return "", fmt.Errorf("failed to create work directory: %v", err)
+		}
+	}
+	dir, err := os.MkdirTemp(cfg.Processing.WorkDir, "gpt-video-transcriber-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create working directory: %v", err)
+	}
+	return dir, nil
+}
+
+// RemoveWorkspace deletes a directory created by NewWorkspace, unless
+// cfg.Processing.KeepTemp asks to keep it for debugging.
+func RemoveWorkspace(cfg Config, dir string) error {
+	if cfg.Processing.KeepTemp {
+		fmt.Printf("Keeping temporary files in %s\n", dir)
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// withWorkspace makes sure cfg.Processing.TempDir is set. Callers that did
+// not create a workspace get one that the returned function removes again.
+func withWorkspace(cfg *Config) (func(), error) {
+	if cfg.Processing.TempDir != "" {
+		return func() {}, nil
+	}
+	dir, err := NewWorkspace(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Processing.TempDir = dir
+	return func() {
+		if err := RemoveWorkspace(*cfg, dir); err != nil {
+			fmt.Printf("Failed to remove working directory '%s': %v\n", dir, err)
+		}
+	}, nil
+}